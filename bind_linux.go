@@ -0,0 +1,20 @@
+//go:build linux
+// +build linux
+
+package quicconn
+
+import (
+	"os"
+	"syscall"
+)
+
+// bindToDevice binds the socket to a network interface using SO_BINDTODEVICE.
+func bindToDevice(c syscall.RawConn, iface string) error {
+	var serr error
+	if err := c.Control(func(fd uintptr) {
+		serr = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, iface)
+	}); err != nil {
+		return err
+	}
+	return os.NewSyscallError("setsockopt", serr)
+}
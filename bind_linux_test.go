@@ -0,0 +1,87 @@
+package quicconn
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"syscall"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Binding to an interface", func() {
+	var (
+		ln            net.Listener
+		serverConns   chan net.Conn
+		clientTLSConf = &tls.Config{InsecureSkipVerify: true}
+	)
+
+	BeforeEach(func() {
+		var err error
+		ln, err = Listen("udp", "127.0.0.1:0", generateTLSConfig())
+		Expect(err).ToNot(HaveOccurred())
+		serverConns = make(chan net.Conn, 1)
+		go func(ln net.Listener, serverConns chan<- net.Conn) {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			serverConns <- c
+		}(ln, serverConns)
+	})
+
+	AfterEach(func() {
+		Expect(ln.Close()).To(Succeed())
+	})
+
+	It("dials from a loopback alias", func() {
+		laddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2)}
+		d := &Dialer{TLSConfig: clientTLSConf, LocalAddr: laddr}
+		c, err := d.Dial("udp", ln.Addr().String())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c.LocalAddr().(*net.UDPAddr).IP.Equal(laddr.IP)).To(BeTrue())
+		var serverConn net.Conn
+		Eventually(serverConns).Should(Receive(&serverConn))
+		Expect(serverConn.RemoteAddr().(*net.UDPAddr).IP.Equal(laddr.IP)).To(BeTrue())
+		Expect(c.(*Conn).CloseWithError(0, "")).To(Succeed())
+	})
+
+	It("binds to the loopback interface", func() {
+		d := &Dialer{
+			TLSConfig: clientTLSConf,
+			LocalAddr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 3)},
+			Interface: "lo",
+		}
+		c, err := d.Dial("udp", ln.Addr().String())
+		if errors.Is(err, syscall.EPERM) {
+			Skip("binding to an interface requires the CAP_NET_RAW capability")
+		}
+		Expect(err).ToNot(HaveOccurred())
+		var serverConn net.Conn
+		Eventually(serverConns).Should(Receive(&serverConn))
+		Expect(serverConn.RemoteAddr().(*net.UDPAddr).IP.Equal(net.IPv4(127, 0, 0, 3))).To(BeTrue())
+		Expect(c.(*Conn).CloseWithError(0, "")).To(Succeed())
+	})
+
+	It("returns an error if the interface doesn't exist", func() {
+		d := &Dialer{TLSConfig: clientTLSConf, Interface: "foobar0"}
+		_, err := d.Dial("udp", ln.Addr().String())
+		Expect(errors.Is(unwrapOpError(err, "dial"), syscall.ENODEV)).To(BeTrue())
+	})
+
+	It("doesn't call the Control function if binding fails", func() {
+		var called bool
+		d := &Dialer{
+			TLSConfig: clientTLSConf,
+			Interface: "foobar0",
+			Control: func(string, string, syscall.RawConn) error {
+				called = true
+				return nil
+			},
+		}
+		_, err := d.Dial("udp", ln.Addr().String())
+		Expect(err).To(HaveOccurred())
+		Expect(called).To(BeFalse())
+	})
+})
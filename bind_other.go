@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package quicconn
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+)
+
+// bindToDevice is only supported on Linux.
+func bindToDevice(syscall.RawConn, string) error {
+	return fmt.Errorf("binding to an interface is not supported on %s", runtime.GOOS)
+}
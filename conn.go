@@ -2,77 +2,683 @@ package quicconn
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"io"
 	"net"
+	"sync"
 	"time"
 
 	quic "github.com/lucas-clemente/quic-go"
 )
 
-type conn struct {
-	session quic.Session
+const (
+	// defaultLinger is the maximum time that Close waits in the background
+	// for data to be delivered, if no linger was set using SetLinger.
+	defaultLinger = 10 * time.Second
+	// drainInterval is the read deadline used when draining the receive stream after Close.
+	// Read calls that are still blocked at that time will return after this interval.
+	drainInterval = 100 * time.Millisecond
+	// copyBufferSize is the size of the buffers used by ReadFrom and WriteTo.
+	// It matches the buffer size used by io.Copy.
+	// Larger buffers don't increase the throughput: the stream only returns data that has already arrived,
+	// and Write hands data to quic-go in packet-sized frames anyway.
+	// WriteTo holds its buffer while blocked in Read, so a small buffer keeps idle connections cheap.
+	copyBufferSize = 32 << 10
+)
 
-	receiveStream quic.Stream
-	sendStream    quic.Stream
+// copyBuffers holds the buffers used by ReadFrom and WriteTo.
+var copyBuffers = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, copyBufferSize)
+		return &b
+	},
 }
 
-func newConn(sess quic.Session) (*conn, error) {
-	stream, err := sess.OpenStream()
+var (
+	errReadClosed  = errors.New("read on closed connection")
+	errWriteClosed = errors.New("write on closed connection")
+)
+
+type perspective int
+
+const (
+	perspectiveServer perspective = 1
+	perspectiveClient perspective = 2
+)
+
+// The stream carrying the data in both directions is the first bidirectional stream opened by the client.
+const streamID quic.StreamID = 0
+
+// The streamPreamble is sent by the client when opening the stream.
+// QUIC only signals a new stream to the peer once data is sent on it,
+// so this allows the server to accept the stream before the client has written any data.
+const streamPreamble byte = 0
+
+var errInvalidPreamble = errors.New("invalid stream preamble")
+
+// A Conn is a QUIC connection, providing a single ordered byte stream.
+// It implements the net.Conn interface.
+type Conn struct {
+	session     quic.Session
+	perspective perspective
+
+	mutex       sync.Mutex // protects stream, streamErr, protocolErr, linger, readEOF and closedWriteFirst
+	stream      quic.Stream
+	streamErr   error
+	protocolErr error // set when the peer violated the protocol
+	linger      int
+	readEOF     bool // set when Read returned io.EOF, i.e. the peer closed its side of the stream
+	// closedWriteFirst is set if the connection was closed for writing before Read returned io.EOF.
+	// The peer then sent its FIN after ours, and is waiting for us to close the session.
+	closedWriteFirst bool
+
+	// writeMutex serializes writes to the stream.
+	// quic-go's Stream.Write must not be called concurrently.
+	writeMutex sync.Mutex
+
+	streamChan     chan struct{} // closed when the stream is available, or accepting it failed
+	closeReadChan  chan struct{} // closed when CloseRead is called
+	closeWriteChan chan struct{} // closed when CloseWrite is called
+	closeChan      chan struct{} // closed when Close is called
+	readDeadline   *deadline
+	writeDeadline  *deadline
+}
+
+// newConn creates a new connection on top of a QUIC session.
+func newConn(sess quic.Session, pers perspective) *Conn {
+	return &Conn{
+		session:        sess,
+		perspective:    pers,
+		linger:         -1,
+		streamChan:     make(chan struct{}),
+		closeReadChan:  make(chan struct{}),
+		closeWriteChan: make(chan struct{}),
+		closeChan:      make(chan struct{}),
+		readDeadline:   newDeadline(),
+		writeDeadline:  newDeadline(),
+	}
+}
+
+// newClientConn creates a new client connection, and opens the stream.
+// The context is used for opening the stream.
+func newClientConn(ctx context.Context, sess quic.Session) (*Conn, error) {
+	c := newConn(sess, perspectiveClient)
+	str, err := sess.OpenStreamSync(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return &conn{
-		session:    sess,
-		sendStream: stream,
-	}, nil
+	if _, err := str.Write([]byte{streamPreamble}); err != nil {
+		return nil, err
+	}
+	c.setStream(str)
+	go c.rejectStreams()
+	go c.rejectUniStreams()
+	return c, nil
+}
+
+// newServerConn creates a new server connection.
+// The stream is accepted in the background, so setting up the connection can't fail.
+// If accepting the stream fails, for example because the client sent an invalid preamble,
+// or because it went away before opening the stream, the error is returned by Read and Write.
+func newServerConn(sess quic.Session) *Conn {
+	c := newConn(sess, perspectiveServer)
+	go c.acceptStreams()
+	go c.rejectUniStreams()
+	return c
+}
+
+// acceptStreams accepts the stream opened by the client.
+// Any other stream opened by the client is rejected.
+// It is run in a separate Go routine, and returns when the session is closed.
+func (c *Conn) acceptStreams() {
+	str, err := c.acceptStream()
+	if err != nil {
+		c.mutex.Lock()
+		c.streamErr = err
+		c.mutex.Unlock()
+		close(c.streamChan)
+		return
+	}
+	c.setStream(str)
+	c.rejectStreams()
+}
+
+// acceptStream accepts the first stream opened by the client, and checks that it is the expected stream.
+func (c *Conn) acceptStream() (quic.Stream, error) {
+	str, err := c.session.AcceptStream(context.Background())
+	if err != nil {
+		return nil, convertError(err)
+	}
+	if id := str.StreamID(); id != streamID {
+		err := &UnexpectedStreamError{StreamID: id}
+		str.CancelWrite(quic.ErrorCode(ErrorCodeProtocolViolation))
+		str.CancelRead(quic.ErrorCode(ErrorCodeProtocolViolation))
+		c.protocolViolation(err)
+		return nil, err
+	}
+	b := make([]byte, 1)
+	if _, err := io.ReadFull(str, b); err != nil {
+		return nil, c.handleError(err)
+	}
+	if b[0] != streamPreamble {
+		c.protocolViolation(errInvalidPreamble)
+		return nil, errInvalidPreamble
+	}
+	return str, nil
+}
+
+// setStream sets the stream, once it is available.
+// It applies the deadlines and the half-closing that happened before.
+func (c *Conn) setStream(str quic.Stream) {
+	defer close(c.streamChan)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.stream = str
+	if isClosedChan(c.closeReadChan) {
+		str.CancelRead(quic.ErrorCode(ErrorCodeNoError))
+	}
+	if isClosedChan(c.closeWriteChan) {
+		str.Close()
+	}
+	readDeadline, writeDeadline := c.readDeadline.get(), c.writeDeadline.get()
+	if isClosedChan(c.closeChan) {
+		// unblock Read and Write calls, see Close
+		readDeadline, writeDeadline = time.Now(), time.Now()
+	}
+	if err := str.SetReadDeadline(readDeadline); err != nil {
+		c.streamErr = err
+	}
+	if err := str.SetWriteDeadline(writeDeadline); err != nil {
+		c.streamErr = err
+	}
 }
 
-func (c *conn) Read(b []byte) (int, error) {
-	if c.receiveStream == nil {
-		var err error
-		c.receiveStream, err = c.session.AcceptStream(context.Background())
-		// TODO: check stream id
+// rejectStreams rejects all bidirectional streams opened by the peer.
+// It is run in a separate Go routine, and returns when the session is closed.
+func (c *Conn) rejectStreams() {
+	for {
+		str, err := c.session.AcceptStream(context.Background())
 		if err != nil {
-			return 0, err
+			return
 		}
-		// quic.Stream.Close() closes the stream for writing
-		err = c.receiveStream.Close()
+		str.CancelWrite(quic.ErrorCode(ErrorCodeProtocolViolation))
+		c.rejectStream(str)
+	}
+}
+
+// rejectUniStreams rejects all unidirectional streams opened by the peer.
+// It is run in a separate Go routine, and returns when the session is closed.
+func (c *Conn) rejectUniStreams() {
+	for {
+		str, err := c.session.AcceptUniStream(context.Background())
 		if err != nil {
-			return 0, err
+			return
 		}
+		c.rejectStream(str)
 	}
+}
 
-	return c.receiveStream.Read(b)
+// rejectStream resets a stream that the peer was not allowed to open,
+// and closes the connection.
+func (c *Conn) rejectStream(str quic.ReceiveStream) {
+	str.CancelRead(quic.ErrorCode(ErrorCodeProtocolViolation))
+	c.protocolViolation(&UnexpectedStreamError{StreamID: str.StreamID()})
 }
 
-func (c *conn) Write(b []byte) (int, error) {
-	return c.sendStream.Write(b)
+// protocolViolation closes the connection because the peer violated the protocol.
+func (c *Conn) protocolViolation(err error) {
+	c.mutex.Lock()
+	if c.protocolErr == nil {
+		c.protocolErr = err
+	}
+	c.mutex.Unlock()
+	c.session.CloseWithError(quic.ErrorCode(ErrorCodeProtocolViolation), err.Error())
+}
+
+// handleError converts errors returned by the stream.
+// If the peer violated the protocol, this error is returned instead.
+func (c *Conn) handleError(err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+	c.mutex.Lock()
+	protocolErr := c.protocolErr
+	c.mutex.Unlock()
+	if protocolErr != nil {
+		return protocolErr
+	}
+	return convertError(err)
+}
+
+// getStream returns the stream.
+// On the server side, it blocks until the stream was opened by the client,
+// the deadline expires, the respective direction is closed, or the connection is closed.
+func (c *Conn) getStream(d *deadline, closeDirChan <-chan struct{}, closeDirErr error) (quic.Stream, error) {
+	select {
+	case <-c.streamChan:
+		return c.acceptedStream()
+	default:
+	}
+
+	select {
+	case <-c.streamChan:
+		return c.acceptedStream()
+	case <-c.closeChan:
+		return nil, ErrClosed
+	case <-closeDirChan:
+		return nil, closeDirErr
+	case <-d.wait():
+		return nil, errDeadline
+	}
+}
+
+// acceptedStream returns the stream.
+// It must only be called after streamChan was closed.
+func (c *Conn) acceptedStream() (quic.Stream, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.stream, c.streamErr
+}
+
+// opError wraps err in a *net.OpError, using the addresses of the connection.
+func (c *Conn) opError(op string, err error) error {
+	return newOpError(op, c.LocalAddr(), c.RemoteAddr(), err)
+}
+
+// Read reads data from the connection.
+// Errors other than io.EOF are returned as a *net.OpError.
+func (c *Conn) Read(b []byte) (int, error) {
+	if isClosedChan(c.closeChan) {
+		return 0, c.opError("read", ErrClosed)
+	}
+	if isClosedChan(c.closeReadChan) {
+		return 0, c.opError("read", errReadClosed)
+	}
+	str, err := c.getStream(c.readDeadline, c.closeReadChan, errReadClosed)
+	if err != nil {
+		return 0, c.opError("read", err)
+	}
+	n, err := str.Read(b)
+	if err == io.EOF {
+		c.mutex.Lock()
+		if !c.readEOF {
+			c.readEOF = true
+			c.closedWriteFirst = isClosedChan(c.closeWriteChan)
+		}
+		c.mutex.Unlock()
+	} else if err != nil && isClosedChan(c.closeChan) {
+		// Close unblocks Read by setting the deadline
+		return n, c.opError("read", ErrClosed)
+	} else if err != nil && isClosedChan(c.closeReadChan) {
+		// CloseRead unblocks Read by canceling the stream for reading
+		return n, c.opError("read", errReadClosed)
+	}
+	return n, c.opError("read", c.handleError(err))
+}
+
+// Write writes data to the connection.
+// Concurrent Write calls don't interleave: the data of each call is written as a whole.
+// Errors are returned as a *net.OpError.
+func (c *Conn) Write(b []byte) (int, error) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	if isClosedChan(c.closeChan) {
+		return 0, c.opError("write", ErrClosed)
+	}
+	if isClosedChan(c.closeWriteChan) {
+		return 0, c.opError("write", errWriteClosed)
+	}
+	str, err := c.getStream(c.writeDeadline, c.closeWriteChan, errWriteClosed)
+	if err != nil {
+		return 0, c.opError("write", err)
+	}
+	n, err := str.Write(b)
+	if err != nil && isClosedChan(c.closeChan) {
+		// Close unblocks Write by setting the deadline
+		return n, c.opError("write", ErrClosed)
+	}
+	return n, c.opError("write", c.handleError(err))
+}
+
+// ReadFrom reads data from r until io.EOF or an error occurs, and writes it to the connection.
+// It implements the io.ReaderFrom interface, allowing io.Copy to use a pooled buffer
+// instead of allocating a new one for every call.
+// It returns the number of bytes written. io.EOF is not reported as an error.
+// Every chunk read from r is written like a single Write call.
+// Reading from r doesn't block concurrent Write calls, nor CloseWrite and Close.
+func (c *Conn) ReadFrom(r io.Reader) (int64, error) {
+	bp := copyBuffers.Get().(*[]byte)
+	defer copyBuffers.Put(bp)
+	b := *bp
+
+	var written int64
+	for {
+		nr, rerr := r.Read(b)
+		if nr > 0 {
+			nw, err := c.Write(b[:nr])
+			written += int64(nw)
+			if err != nil {
+				return written, err
+			}
+		}
+		if rerr == io.EOF {
+			return written, nil
+		}
+		if rerr != nil {
+			return written, rerr
+		}
+	}
+}
+
+// WriteTo reads data from the connection until io.EOF or an error occurs, and writes it to w.
+// It implements the io.WriterTo interface, allowing io.Copy to use a pooled buffer
+// instead of allocating a new one for every call.
+// It returns the number of bytes written. io.EOF is not reported as an error.
+func (c *Conn) WriteTo(w io.Writer) (int64, error) {
+	bp := copyBuffers.Get().(*[]byte)
+	defer copyBuffers.Put(bp)
+	b := *bp
+
+	var written int64
+	for {
+		nr, rerr := c.Read(b)
+		if nr > 0 {
+			nw, err := w.Write(b[:nr])
+			written += int64(nw)
+			if err != nil {
+				return written, err
+			}
+			if nw != nr {
+				return written, io.ErrShortWrite
+			}
+		}
+		if rerr == io.EOF {
+			return written, nil
+		}
+		if rerr != nil {
+			return written, rerr
+		}
+	}
 }
 
 // LocalAddr returns the local network address.
 // needed to fulfill the net.Conn interface
-func (c *conn) LocalAddr() net.Addr {
+func (c *Conn) LocalAddr() net.Addr {
 	return c.session.LocalAddr()
 }
 
 // RemoteAddr returns the remote network address.
-func (c *conn) RemoteAddr() net.Addr {
+func (c *Conn) RemoteAddr() net.Addr {
 	return c.session.RemoteAddr()
 }
 
-func (c *conn) Close() error {
-	return c.session.Close()
+// ConnectionState returns basic TLS details about the connection,
+// including the negotiated application protocol and the peer's certificates.
+func (c *Conn) ConnectionState() tls.ConnectionState {
+	return c.session.ConnectionState()
+}
+
+// DidResume reports whether the TLS session was resumed,
+// using a session ticket received on a previous connection.
+// See Dialer.ClientSessionCache for enabling session resumption.
+func (c *Conn) DidResume() bool {
+	return c.session.ConnectionState().DidResume
 }
 
-func (c *conn) SetDeadline(t time.Time) error {
+// Session returns the underlying QUIC session.
+// Opening or accepting streams on the session violates the protocol.
+func (c *Conn) Session() quic.Session {
+	return c.session
+}
+
+// Context returns a context that is canceled when the underlying QUIC session is closed.
+func (c *Conn) Context() context.Context {
+	return c.session.Context()
+}
+
+// CloseWrite shuts down the writing side of the connection.
+// The peer's Read will return io.EOF once it has read all data sent before.
+// Reading from the connection is still possible.
+// A Write call that is in progress completes before the stream is closed,
+// so that all its data is sent before the FIN.
+func (c *Conn) CloseWrite() error {
+	c.mutex.Lock()
+	if isClosedChan(c.closeWriteChan) {
+		c.mutex.Unlock()
+		return nil
+	}
+	// unblock Write calls waiting for the stream
+	close(c.closeWriteChan)
+	c.mutex.Unlock()
+
+	// quic-go's Stream.Close must not be called concurrently with Write.
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	c.mutex.Lock()
+	str := c.stream
+	c.mutex.Unlock()
+	if str == nil {
+		// setStream closes the stream once it is available
+		return nil
+	}
+	return c.opError("close", str.Close())
+}
+
+// CloseRead shuts down the reading side of the connection.
+// The peer is asked to stop sending, and any blocked Read is unblocked.
+// Writing to the connection is still possible.
+func (c *Conn) CloseRead() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if isClosedChan(c.closeReadChan) {
+		return nil
+	}
+	close(c.closeReadChan)
+	if c.stream != nil {
+		c.stream.CancelRead(quic.ErrorCode(ErrorCodeNoError))
+	}
 	return nil
 }
 
-func (c *conn) SetReadDeadline(t time.Time) error {
+// SetLinger sets the behavior of Close on a connection which still has data
+// waiting to be sent or to be acknowledged, analogous to (*net.TCPConn).SetLinger.
+//
+// If sec < 0 (the default), Close returns immediately, and the QUIC session is kept alive
+// in the background until the peer has closed its side of the connection, but at most for 10 seconds.
+//
+// If sec == 0, Close closes the QUIC session immediately, and any unsent or unacknowledged data is discarded.
+//
+// If sec > 0, Close blocks until the peer has closed its side of the connection,
+// but at most for sec seconds. After that, any remaining data is discarded.
+//
+// If Read already returned io.EOF when Close is called, but the connection was not closed for writing before,
+// the peer is expected to read the remaining data, and to close the QUIC session afterwards.
+// Close then waits for the peer to close the QUIC session.
+// If the connection was closed for writing before Read returned io.EOF, both sides are done,
+// and Close closes the QUIC session right away.
+func (c *Conn) SetLinger(sec int) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.linger = sec
 	return nil
 }
 
-func (c *conn) SetWriteDeadline(t time.Time) error {
+// Close closes the connection.
+// Any blocked Read or Write operations will be unblocked and return errors.
+// Data that was written before is still delivered to the peer, see SetLinger.
+// Half-closing the connection using CloseWrite and CloseRead keeps the QUIC session alive,
+// so Close needs to be called to release it.
+func (c *Conn) Close() error {
+	linger, ok := c.markClosed()
+	if !ok {
+		return c.opError("close", ErrClosed)
+	}
+	if linger == 0 {
+		return c.opError("close", c.session.Close())
+	}
+	if err := c.unblock(); err != nil {
+		c.session.Close()
+		return c.opError("close", err)
+	}
+	// Closing the stream for writing makes sure that a FIN is sent after all data written so far.
+	if err := c.CloseWrite(); err != nil {
+		c.session.Close()
+		return err
+	}
+	if linger < 0 {
+		go c.lingerAndClose(defaultLinger)
+		return nil
+	}
+	return c.opError("close", c.lingerAndClose(time.Duration(linger)*time.Second))
+}
+
+// CloseWithError closes the connection with an application error code and a reason.
+// The peer's Read and Write calls will return an *ApplicationError carrying the code and the reason.
+// The code must be smaller than 2^62, otherwise an error is returned and the connection is not closed.
+// Unlike Close, it closes the QUIC session immediately, and data that was not yet delivered is discarded.
+func (c *Conn) CloseWithError(code uint64, reason string) error {
+	if err := checkErrorCode(code); err != nil {
+		return c.opError("close", err)
+	}
+	if _, ok := c.markClosed(); !ok {
+		return c.opError("close", ErrClosed)
+	}
+	return c.opError("close", c.session.CloseWithError(quic.ErrorCode(code), reason))
+}
+
+// unblock unblocks Read and Write calls after the connection was marked closed.
+// Calls waiting for the stream are unblocked by closeChan, calls blocked on the stream by expiring its deadlines.
+// The deadlines of the connection are not modified.
+func (c *Conn) unblock() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.stream == nil {
+		// setStream expires the deadlines of the stream
+		return nil
+	}
+	now := time.Now()
+	if err := c.stream.SetReadDeadline(now); err != nil {
+		return err
+	}
+	return c.stream.SetWriteDeadline(now)
+}
+
+// markClosed marks the connection as closed, and returns the linger value.
+// It returns false if the connection was already closed.
+func (c *Conn) markClosed() (int, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if isClosedChan(c.closeChan) {
+		return 0, false
+	}
+	close(c.closeChan)
+	return c.linger, true
+}
+
+// lingerAndClose closes the QUIC session as soon as the peer has closed its side of the connection,
+// or after the timeout.
+// The peer's side of the connection is closed if it closed the QUIC session,
+// or if it closed the stream for writing (and all data sent on it was read).
+// If the peer closed the stream for writing before we did, it might still be reading the data
+// sent by us, and closing the QUIC session would discard data not yet delivered.
+// In that case, the peer's side of the connection is only closed once it closes the QUIC session.
+// The peer does so once it read our FIN, since it closed the stream for writing before that.
+func (c *Conn) lingerAndClose(timeout time.Duration) error {
+	c.mutex.Lock()
+	readEOF := c.readEOF
+	closedWriteFirst := c.closedWriteFirst
+	c.mutex.Unlock()
+	if readEOF && closedWriteFirst {
+		return c.session.Close()
+	}
+
+	peerClosed := make(chan struct{})
+	go func() {
+		if readEOF {
+			return
+		}
+		// If the stream is never accepted, closing the session unblocks this.
+		<-c.streamChan
+		if str, err := c.acceptedStream(); err == nil && c.drain(str) {
+			close(peerClosed)
+		}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-peerClosed:
+	case <-c.session.Context().Done():
+	case <-timer.C:
+	}
+	return c.session.Close()
+}
+
+// drain discards all data received on the stream, until the peer closes it.
+// It returns true if the peer closed the stream.
+// If reading fails, for example because the connection was closed for reading,
+// there's no way to tell if the peer is done.
+func (c *Conn) drain(str quic.Stream) bool {
+	b := make([]byte, 1<<10)
+	for {
+		// Read calls that are still blocked are unblocked when the deadline expires.
+		if err := str.SetReadDeadline(time.Now().Add(drainInterval)); err != nil {
+			return false
+		}
+		_, err := str.Read(b)
+		if err == io.EOF {
+			return true
+		}
+		if isClosedChan(c.session.Context().Done()) {
+			return false
+		}
+		if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+			continue
+		}
+		if err != nil {
+			return false
+		}
+	}
+}
+
+// SetDeadline sets the read and write deadlines associated with the connection.
+// It is equivalent to calling both SetReadDeadline and SetWriteDeadline.
+func (c *Conn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the deadline for future Read calls and any currently-blocked Read call.
+// On the server side, this includes a Read that is still waiting for the client to open the stream.
+// A zero value for t means Read will not time out.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.readDeadline.set(t)
+	if c.stream != nil {
+		return c.opError("set", c.stream.SetReadDeadline(t))
+	}
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for future Write calls and any currently-blocked Write call.
+// On the server side, this includes a Write that is still waiting for the client to open the stream.
+// A zero value for t means Write will not time out.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.writeDeadline.set(t)
+	if c.stream != nil {
+		return c.opError("set", c.stream.SetWriteDeadline(t))
+	}
 	return nil
 }
 
-var _ net.Conn = &conn{}
+var _ net.Conn = &Conn{}
+var _ io.ReaderFrom = &Conn{}
+var _ io.WriterTo = &Conn{}
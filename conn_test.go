@@ -1,10 +1,13 @@
 package quicconn
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"errors"
+	"io/ioutil"
 	"net"
+	"sync"
 	"time"
 
 	quic "github.com/lucas-clemente/quic-go"
@@ -13,28 +16,49 @@ import (
 )
 
 type mockSession struct {
-	remoteAddr net.Addr
-	localAddr  net.Addr
+	remoteAddr      net.Addr
+	localAddr       net.Addr
+	connectionState tls.ConnectionState
 
-	streamToAccept quic.Stream
-	acceptError    error
+	streamsToAccept    chan quic.Stream
+	uniStreamsToAccept chan quic.ReceiveStream
+	acceptErrors       chan error
 
 	streamToOpen quic.Stream
 	openError    error
 
+	ctx       context.Context
+	ctxCancel context.CancelFunc
+
+	mutex           sync.Mutex
 	closed          bool
+	closedWithCode  quic.ErrorCode
 	closedWithError string
 }
 
-func (m *mockSession) AcceptStream(context.Context) (quic.Stream, error) {
-	if m.acceptError != nil {
-		return nil, m.acceptError
+func newMockSession() *mockSession {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &mockSession{
+		streamsToAccept:    make(chan quic.Stream, 10),
+		uniStreamsToAccept: make(chan quic.ReceiveStream, 10),
+		acceptErrors:       make(chan error, 10),
+		ctx:                ctx,
+		ctxCancel:          cancel,
 	}
-	// AcceptStream blocks until a stream is available
-	if m.streamToAccept == nil {
-		time.Sleep(time.Hour)
+}
+
+// AcceptStream blocks until a stream or an error is queued, or the session is closed
+func (m *mockSession) AcceptStream(ctx context.Context) (quic.Stream, error) {
+	select {
+	case str := <-m.streamsToAccept:
+		return str, nil
+	case err := <-m.acceptErrors:
+		return nil, err
+	case <-m.ctx.Done():
+		return nil, errors.New("session closed")
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
-	return m.streamToAccept, nil
 }
 
 func (m *mockSession) OpenStream() (quic.Stream, error) {
@@ -44,7 +68,15 @@ func (m *mockSession) OpenStream() (quic.Stream, error) {
 	return m.streamToOpen, nil
 }
 
-func (m *mockSession) OpenStreamSync(context.Context) (quic.Stream, error) {
+// OpenStreamSync blocks until the context is canceled if there's no stream to open
+func (m *mockSession) OpenStreamSync(ctx context.Context) (quic.Stream, error) {
+	if m.openError != nil {
+		return nil, m.openError
+	}
+	if m.streamToOpen == nil {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
 	return m.streamToOpen, nil
 }
 
@@ -56,52 +88,63 @@ func (m *mockSession) RemoteAddr() net.Addr {
 	return m.remoteAddr
 }
 
-func (m *mockSession) CloseWithError(_ quic.ErrorCode, e string) error {
+func (m *mockSession) CloseWithError(code quic.ErrorCode, e string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.closedWithCode = code
 	m.closedWithError = e
 	m.closed = true
+	m.ctxCancel()
 	return nil
 }
 
+func (m *mockSession) isClosed() bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.closed
+}
+
 func (m *mockSession) Close() error {
 	return m.CloseWithError(0, "")
 }
 
-func (m *mockSession) AcceptUniStream(context.Context) (quic.ReceiveStream, error) {
-	panic("not implemented")
+func (m *mockSession) AcceptUniStream(ctx context.Context) (quic.ReceiveStream, error) {
+	select {
+	case str := <-m.uniStreamsToAccept:
+		return str, nil
+	case <-m.ctx.Done():
+		return nil, errors.New("session closed")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 }
 func (m *mockSession) OpenUniStream() (quic.SendStream, error) { panic("not implemented") }
 func (m *mockSession) OpenUniStreamSync(context.Context) (quic.SendStream, error) {
 	panic("not implemented")
 }
-func (m *mockSession) ConnectionState() tls.ConnectionState { panic("not implemented") }
-func (m *mockSession) Context() context.Context             { panic("not implemented") }
+func (m *mockSession) ConnectionState() tls.ConnectionState { return m.connectionState }
+func (m *mockSession) Context() context.Context             { return m.ctx }
 
 var _ quic.Session = &mockSession{}
 
 var _ = Describe("Conn", func() {
 	var (
-		c             *conn
-		sess          *mockSession
-		sendStream    *mockStream
-		receiveStream *mockStream
+		c    *Conn
+		sess *mockSession
+		str  *mockStream
 	)
 
-	BeforeEach(func() {
-		var err error
-		receiveStream = &mockStream{}
-		sendStream = &mockStream{}
-		sess = &mockSession{
-			streamToOpen: sendStream,
-		}
-		c, err = newConn(sess)
-		Expect(err).ToNot(HaveOccurred())
-	})
+	// acceptStream makes the client open the stream, and waits until the server accepted it
+	acceptStream := func() {
+		str.dataToRead.Write([]byte{streamPreamble})
+		sess.streamsToAccept <- str
+		Eventually(c.streamChan).Should(BeClosed())
+	}
 
-	It("errors when the send stream can't be opened", func() {
-		testErr := errors.New("test error")
-		sess.openError = testErr
-		_, err := newConn(sess)
-		Expect(err).To(MatchError(testErr))
+	BeforeEach(func() {
+		str = &mockStream{id: streamID}
+		sess = newMockSession()
+		c = newServerConn(sess)
 	})
 
 	It("returns the remote address", func() {
@@ -110,50 +153,145 @@ var _ = Describe("Conn", func() {
 		Expect(c.RemoteAddr()).To(Equal(addr))
 	})
 
+	It("returns the connection state", func() {
+		sess.connectionState = tls.ConnectionState{NegotiatedProtocol: "foo", ServerName: "bar"}
+		Expect(c.ConnectionState()).To(Equal(sess.connectionState))
+	})
+
+	It("reports if the session was resumed", func() {
+		Expect(c.DidResume()).To(BeFalse())
+		sess.connectionState = tls.ConnectionState{DidResume: true}
+		Expect(c.DidResume()).To(BeTrue())
+	})
+
+	It("returns the session", func() {
+		Expect(c.Session()).To(Equal(sess))
+	})
+
+	It("returns the context of the session", func() {
+		Expect(c.Context()).ToNot(BeNil())
+		Expect(c.Context().Done()).ToNot(BeClosed())
+		sess.ctxCancel()
+		Expect(c.Context().Done()).To(BeClosed())
+	})
+
+	It("populates the addresses of errors", func() {
+		local := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1337}
+		remote := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 7331}
+		sess.localAddr = local
+		sess.remoteAddr = remote
+		Expect(c.SetReadDeadline(time.Now().Add(-time.Second))).To(Succeed())
+		_, err := c.Read(make([]byte, 1))
+		Expect(err).To(BeAssignableToTypeOf(&net.OpError{}))
+		Expect(err.(*net.OpError).Source).To(Equal(local))
+		Expect(err.(*net.OpError).Addr).To(Equal(remote))
+	})
+
 	It("returns the local address", func() {
 		addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1337}
 		sess.localAddr = addr
 		Expect(c.LocalAddr()).To(Equal(addr))
 	})
 
+	Context("client", func() {
+		It("opens the stream and sends the preamble", func() {
+			sess := newMockSession()
+			str := &mockStream{id: streamID}
+			sess.streamToOpen = str
+			c, err := newClientConn(context.Background(), sess)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.streamChan).To(BeClosed())
+			Expect(str.dataWritten.Bytes()).To(Equal([]byte{streamPreamble}))
+		})
+
+		It("errors when the stream can't be opened", func() {
+			testErr := errors.New("test error")
+			sess.openError = testErr
+			_, err := newClientConn(context.Background(), sess)
+			Expect(err).To(MatchError(testErr))
+		})
+
+		It("stops opening the stream when the context is canceled", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			_, err := newClientConn(ctx, sess)
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+		})
+
+		It("errors when the preamble can't be sent", func() {
+			testErr := errors.New("test error")
+			sess.streamToOpen = &mockStream{id: streamID, writeErr: testErr}
+			_, err := newClientConn(context.Background(), sess)
+			Expect(err).To(MatchError(testErr))
+		})
+
+		It("rejects streams opened by the server", func() {
+			sess := newMockSession()
+			sess.streamToOpen = &mockStream{id: streamID}
+			_, err := newClientConn(context.Background(), sess)
+			Expect(err).ToNot(HaveOccurred())
+			str := &mockStream{id: 1}
+			sess.streamsToAccept <- str
+			Eventually(sess.isClosed).Should(BeTrue())
+			Expect(sess.closedWithCode).To(BeEquivalentTo(ErrorCodeProtocolViolation))
+			str.mutex.Lock()
+			Expect(str.canceledRead).To(BeTrue())
+			Expect(str.canceledWrite).To(BeTrue())
+			str.mutex.Unlock()
+		})
+	})
+
 	It("writes data", func() {
+		acceptStream()
 		n, err := c.Write([]byte("foobar"))
 		Expect(err).ToNot(HaveOccurred())
 		Expect(n).To(Equal(6))
-		Expect(sendStream.dataWritten.Bytes()).To(Equal([]byte("foobar")))
+		Expect(str.dataWritten.Bytes()).To(Equal([]byte("foobar")))
 	})
 
-	It("waits with reading until a stream can be accepted", func() {
-		var readReturned bool
+	It("waits with writing until the stream is accepted", func() {
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			_, err := c.Write([]byte("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+			close(done)
+		}()
+
+		Consistently(done).ShouldNot(BeClosed())
+		acceptStream()
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("waits with reading until the stream is accepted", func() {
+		done := make(chan struct{})
 		go func() {
 			defer GinkgoRecover()
 			_, err := c.Read(make([]byte, 1))
 			Expect(err).ToNot(HaveOccurred())
-			readReturned = true
+			close(done)
 		}()
 
-		Consistently(func() bool { return readReturned }).Should(BeFalse())
+		Consistently(done).ShouldNot(BeClosed())
+		str.dataToRead.Write([]byte{streamPreamble})
+		str.dataToRead.Write([]byte("foobar"))
+		sess.streamsToAccept <- str
+		Eventually(done).Should(BeClosed())
 	})
 
 	It("errors if accepting the stream fails", func() {
 		testErr := errors.New("test error")
-		sess.acceptError = testErr
+		sess.acceptErrors <- testErr
 		_, err := c.Read(make([]byte, 1))
-		Expect(err).To(MatchError(testErr))
-	})
-
-	It("immediately closes the receive stream", func() {
-		receiveStream.dataToRead.Write([]byte("foobar"))
-		sess.streamToAccept = receiveStream
-
-		_, err := c.Read(make([]byte, 1))
-		Expect(err).ToNot(HaveOccurred())
-		Expect(receiveStream.closed).To(BeTrue())
+		Expect(unwrapOpError(err, "read")).To(MatchError(testErr))
+		_, err = c.Write([]byte("foobar"))
+		Expect(unwrapOpError(err, "write")).To(MatchError(testErr))
 	})
 
 	It("reads data", func() {
-		receiveStream.dataToRead.Write([]byte("foobar"))
-		sess.streamToAccept = receiveStream
+		str.dataToRead.Write([]byte{streamPreamble})
+		str.dataToRead.Write([]byte("foobar"))
+		sess.streamsToAccept <- str
 
 		data := make([]byte, 10)
 		n, err := c.Read(data)
@@ -162,9 +300,503 @@ var _ = Describe("Conn", func() {
 		Expect(data).To(ContainSubstring("foobar"))
 	})
 
-	It("closes", func() {
-		c.Close()
-		Expect(sess.closed).To(BeTrue())
-		Expect(sess.closedWithError).To(BeEmpty())
+	Context("copying", func() {
+		It("reads from a reader", func() {
+			acceptStream()
+			data := bytes.Repeat([]byte("foobar"), 1<<17)
+			n, err := c.ReadFrom(bytes.NewReader(data))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(BeEquivalentTo(len(data)))
+			Expect(str.dataWritten.Bytes()).To(Equal(data))
+		})
+
+		It("returns write errors when reading from a reader", func() {
+			acceptStream()
+			testErr := errors.New("test error")
+			str.mutex.Lock()
+			str.writeErr = testErr
+			str.mutex.Unlock()
+			n, err := c.ReadFrom(bytes.NewReader([]byte("foobar")))
+			Expect(n).To(BeZero())
+			Expect(unwrapOpError(err, "write")).To(MatchError(testErr))
+		})
+
+		It("writes to a writer", func() {
+			data := bytes.Repeat([]byte("foobar"), 1<<17)
+			acceptStream()
+			str.mutex.Lock()
+			str.dataToRead.Write(data) // str.Read returns io.EOF after reading all data
+			str.mutex.Unlock()
+			var b bytes.Buffer
+			n, err := c.WriteTo(&b)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(BeEquivalentTo(len(data)))
+			Expect(b.Bytes()).To(Equal(data))
+		})
+
+		It("returns read errors when writing to a writer", func() {
+			acceptStream()
+			testErr := errors.New("test error")
+			str.mutex.Lock()
+			str.readErr = testErr
+			str.mutex.Unlock()
+			n, err := c.WriteTo(&bytes.Buffer{})
+			Expect(n).To(BeZero())
+			Expect(unwrapOpError(err, "read")).To(MatchError(testErr))
+		})
+	})
+
+	Context("validating streams", func() {
+		It("rejects an unexpected first stream", func() {
+			str := &mockStream{id: 4}
+			sess.streamsToAccept <- str
+			_, err := c.Read(make([]byte, 1))
+			Expect(unwrapOpError(err, "read")).To(Equal(&UnexpectedStreamError{StreamID: 4}))
+			Expect(str.canceledRead).To(BeTrue())
+			Expect(str.canceledWrite).To(BeTrue())
+			Expect(sess.isClosed()).To(BeTrue())
+			Expect(sess.closedWithCode).To(BeEquivalentTo(ErrorCodeProtocolViolation))
+		})
+
+		It("rejects an invalid preamble", func() {
+			str.dataToRead.Write([]byte{0x42})
+			sess.streamsToAccept <- str
+			_, err := c.Read(make([]byte, 1))
+			Expect(unwrapOpError(err, "read")).To(MatchError(errInvalidPreamble))
+			Expect(sess.isClosed()).To(BeTrue())
+			Expect(sess.closedWithCode).To(BeEquivalentTo(ErrorCodeProtocolViolation))
+		})
+
+		It("rejects additional streams", func() {
+			acceptStream()
+			str2 := &mockStream{id: 4}
+			sess.streamsToAccept <- str2
+			Eventually(sess.isClosed).Should(BeTrue())
+			Expect(sess.closedWithCode).To(BeEquivalentTo(ErrorCodeProtocolViolation))
+			str2.mutex.Lock()
+			Expect(str2.canceledRead).To(BeTrue())
+			Expect(str2.canceledWrite).To(BeTrue())
+			str2.mutex.Unlock()
+			str.mutex.Lock()
+			str.readErr = errors.New("session closed")
+			str.writeErr = errors.New("session closed")
+			str.mutex.Unlock()
+			_, err := c.Read(make([]byte, 1))
+			Expect(unwrapOpError(err, "read")).To(Equal(&UnexpectedStreamError{StreamID: 4}))
+			_, err = c.Write([]byte("foobar"))
+			Expect(unwrapOpError(err, "write")).To(Equal(&UnexpectedStreamError{StreamID: 4}))
+		})
+
+		It("rejects unidirectional streams", func() {
+			str := &mockStream{id: 2}
+			sess.uniStreamsToAccept <- str
+			Eventually(sess.isClosed).Should(BeTrue())
+			Expect(sess.closedWithCode).To(BeEquivalentTo(ErrorCodeProtocolViolation))
+			str.mutex.Lock()
+			Expect(str.canceledRead).To(BeTrue())
+			str.mutex.Unlock()
+		})
+	})
+
+	Context("deadlines", func() {
+		It("sets the deadlines on the stream", func() {
+			acceptStream()
+			readDeadline := time.Now().Add(time.Hour)
+			writeDeadline := time.Now().Add(time.Minute)
+			Expect(c.SetReadDeadline(readDeadline)).To(Succeed())
+			Expect(c.SetWriteDeadline(writeDeadline)).To(Succeed())
+			Expect(str.readDeadline).To(Equal(readDeadline))
+			Expect(str.writeDeadline).To(Equal(writeDeadline))
+		})
+
+		It("sets the deadlines on the stream when it is accepted", func() {
+			readDeadline := time.Now().Add(time.Hour)
+			writeDeadline := time.Now().Add(time.Minute)
+			Expect(c.SetReadDeadline(readDeadline)).To(Succeed())
+			Expect(c.SetWriteDeadline(writeDeadline)).To(Succeed())
+			acceptStream()
+			Expect(str.readDeadline).To(Equal(readDeadline))
+			Expect(str.writeDeadline).To(Equal(writeDeadline))
+		})
+
+		It("sets both deadlines", func() {
+			acceptStream()
+			deadline := time.Now().Add(time.Hour)
+			Expect(c.SetDeadline(deadline)).To(Succeed())
+			Expect(str.readDeadline).To(Equal(deadline))
+			Expect(str.writeDeadline).To(Equal(deadline))
+		})
+
+		It("times out a Read waiting for the stream", func() {
+			Expect(c.SetReadDeadline(time.Now().Add(50 * time.Millisecond))).To(Succeed())
+			_, err := c.Read(make([]byte, 1))
+			Expect(err).To(HaveOccurred())
+			nerr, ok := err.(net.Error)
+			Expect(ok).To(BeTrue())
+			Expect(nerr.Timeout()).To(BeTrue())
+		})
+
+		It("times out a Write waiting for the stream", func() {
+			Expect(c.SetWriteDeadline(time.Now().Add(50 * time.Millisecond))).To(Succeed())
+			_, err := c.Write([]byte("foobar"))
+			Expect(err).To(HaveOccurred())
+			nerr, ok := err.(net.Error)
+			Expect(ok).To(BeTrue())
+			Expect(nerr.Timeout()).To(BeTrue())
+		})
+
+		It("times out a Read when the deadline is already expired", func() {
+			Expect(c.SetReadDeadline(time.Now().Add(-time.Second))).To(Succeed())
+			_, err := c.Read(make([]byte, 1))
+			Expect(unwrapOpError(err, "read")).To(MatchError(errDeadline))
+		})
+
+		It("unblocks a Read waiting for the stream when the deadline is set", func() {
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				_, err := c.Read(make([]byte, 1))
+				Expect(unwrapOpError(err, "read")).To(MatchError(errDeadline))
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			Expect(c.SetReadDeadline(time.Now())).To(Succeed())
+			Eventually(done).Should(BeClosed())
+		})
+	})
+
+	Context("half-closing", func() {
+		It("closes for writing", func() {
+			acceptStream()
+			Expect(c.CloseWrite()).To(Succeed())
+			Expect(str.closed).To(BeTrue())
+			Expect(str.canceledRead).To(BeFalse())
+			Expect(sess.isClosed()).To(BeFalse())
+			_, err := c.Write([]byte("foobar"))
+			Expect(unwrapOpError(err, "write")).To(MatchError(errWriteClosed))
+		})
+
+		It("waits for a Write in progress before closing for writing", func() {
+			acceptStream()
+			str.mutex.Lock()
+			str.blockWrite = make(chan struct{})
+			str.mutex.Unlock()
+			writeDone := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				_, err := c.Write([]byte("foobar"))
+				Expect(err).ToNot(HaveOccurred())
+				close(writeDone)
+			}()
+			Consistently(writeDone).ShouldNot(BeClosed())
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				Expect(c.CloseWrite()).To(Succeed())
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			close(str.blockWrite)
+			Eventually(done).Should(BeClosed())
+			Expect(writeDone).To(BeClosed())
+			str.mutex.Lock()
+			defer str.mutex.Unlock()
+			Expect(str.closed).To(BeTrue())
+			Expect(str.dataWritten.String()).To(Equal("foobar"))
+		})
+
+		It("closes for reading", func() {
+			acceptStream()
+			Expect(c.CloseRead()).To(Succeed())
+			Expect(str.canceledRead).To(BeTrue())
+			Expect(str.closed).To(BeFalse())
+			Expect(sess.isClosed()).To(BeFalse())
+			_, err := c.Read(make([]byte, 1))
+			Expect(unwrapOpError(err, "read")).To(MatchError(errReadClosed))
+		})
+
+		It("returns the same error from a blocked Read when closed for reading", func() {
+			acceptStream()
+			str.mutex.Lock()
+			str.blockRead = make(chan struct{})
+			str.readErr = errors.New("Read on stream 0 canceled with error code 0")
+			str.mutex.Unlock()
+			errChan := make(chan error, 1)
+			go func() {
+				_, err := c.Read(make([]byte, 1))
+				errChan <- err
+			}()
+			Consistently(errChan).ShouldNot(Receive())
+			Expect(c.CloseRead()).To(Succeed())
+			close(str.blockRead)
+			var err error
+			Eventually(errChan).Should(Receive(&err))
+			Expect(unwrapOpError(err, "read")).To(MatchError(errReadClosed))
+		})
+
+		It("unblocks a Read waiting for the stream when closed for reading", func() {
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				_, err := c.Read(make([]byte, 1))
+				Expect(unwrapOpError(err, "read")).To(MatchError(errReadClosed))
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			Expect(c.CloseRead()).To(Succeed())
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("half-closes a stream accepted after half-closing", func() {
+			Expect(c.CloseRead()).To(Succeed())
+			Expect(c.CloseWrite()).To(Succeed())
+			acceptStream()
+			Expect(str.canceledRead).To(BeTrue())
+			Expect(str.closed).To(BeTrue())
+		})
+	})
+
+	It("is safe for concurrent use", func() {
+		Expect(c.SetLinger(0)).To(Succeed())
+		var wg sync.WaitGroup
+		wg.Add(3 * 5)
+		for i := 0; i < 5; i++ {
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					if _, err := c.Read(make([]byte, 1)); errors.Is(err, ErrClosed) {
+						return
+					}
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					c.Write([]byte("foobar"))
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				c.SetDeadline(time.Now().Add(10 * time.Millisecond))
+			}()
+		}
+		str.dataToRead.Write([]byte{streamPreamble})
+		str.dataToRead.Write([]byte("foobar"))
+		sess.streamsToAccept <- str
+		Expect(c.Close()).To(Succeed())
+		wg.Wait()
+	})
+
+	Context("closing", func() {
+		It("closes immediately when lingering is disabled", func() {
+			Expect(c.SetLinger(0)).To(Succeed())
+			Expect(c.Close()).To(Succeed())
+			Expect(sess.isClosed()).To(BeTrue())
+			Expect(sess.closedWithError).To(BeEmpty())
+		})
+
+		It("keeps the session open in the background", func() {
+			Expect(c.Close()).To(Succeed())
+			Consistently(sess.isClosed).Should(BeFalse())
+		})
+
+		It("closes the stream for writing", func() {
+			acceptStream()
+			Expect(c.Close()).To(Succeed())
+			Expect(str.closed).To(BeTrue())
+		})
+
+		It("expires the deadlines of the stream without changing the deadlines of the connection", func() {
+			deadline := time.Now().Add(time.Hour)
+			Expect(c.SetDeadline(deadline)).To(Succeed())
+			acceptStream()
+			Expect(c.Close()).To(Succeed())
+			str.mutex.Lock()
+			Expect(str.readDeadline).To(BeTemporally("<", deadline))
+			Expect(str.writeDeadline).To(BeTemporally("<", deadline))
+			str.mutex.Unlock()
+			Expect(c.readDeadline.get()).To(Equal(deadline))
+			Expect(c.writeDeadline.get()).To(Equal(deadline))
+		})
+
+		It("expires the deadlines of a stream accepted after closing", func() {
+			deadline := time.Now().Add(time.Hour)
+			Expect(c.SetDeadline(deadline)).To(Succeed())
+			Expect(c.Close()).To(Succeed())
+			acceptStream()
+			str.mutex.Lock()
+			Expect(str.readDeadline).To(BeTemporally("<", deadline))
+			Expect(str.writeDeadline).To(BeTemporally("<", deadline))
+			str.mutex.Unlock()
+		})
+
+		It("closes the session once the peer closes the stream", func() {
+			acceptStream()
+			str.mutex.Lock()
+			str.dataToRead.Write([]byte("foobar")) // str.Read returns io.EOF after reading all data
+			str.mutex.Unlock()
+			Expect(c.Close()).To(Succeed())
+			Eventually(sess.isClosed).Should(BeTrue())
+			Expect(sess.closedWithCode).To(BeEquivalentTo(ErrorCodeNoError))
+		})
+
+		It("waits until the peer closes the session", func() {
+			Expect(c.SetLinger(10)).To(Succeed())
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				Expect(c.Close()).To(Succeed())
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			sess.ctxCancel()
+			Eventually(done).Should(BeClosed())
+			Expect(sess.isClosed()).To(BeTrue())
+		})
+
+		It("waits for the peer to close the session, if the peer closed the stream before", func() {
+			Expect(c.SetLinger(10)).To(Succeed())
+			acceptStream()
+			str.mutex.Lock()
+			str.dataToRead.Write([]byte("foobar")) // str.Read returns io.EOF after reading all data
+			str.mutex.Unlock()
+			_, err := ioutil.ReadAll(c)
+			Expect(err).ToNot(HaveOccurred())
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				Expect(c.Close()).To(Succeed())
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			Expect(sess.isClosed()).To(BeFalse())
+			sess.ctxCancel()
+			Eventually(done).Should(BeClosed())
+			Expect(sess.isClosed()).To(BeTrue())
+		})
+
+		It("closes the session right away, if we closed the stream before the peer", func() {
+			Expect(c.SetLinger(10)).To(Succeed())
+			acceptStream()
+			Expect(c.CloseWrite()).To(Succeed())
+			str.mutex.Lock()
+			str.dataToRead.Write([]byte("foobar")) // str.Read returns io.EOF after reading all data
+			str.mutex.Unlock()
+			_, err := ioutil.ReadAll(c)
+			Expect(err).ToNot(HaveOccurred())
+			start := time.Now()
+			Expect(c.Close()).To(Succeed())
+			Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+			Expect(sess.isClosed()).To(BeTrue())
+			Expect(sess.closedWithCode).To(BeEquivalentTo(ErrorCodeNoError))
+		})
+
+		It("stops lingering after the timeout", func() {
+			Expect(c.SetLinger(1)).To(Succeed())
+			start := time.Now()
+			Expect(c.Close()).To(Succeed())
+			Expect(time.Since(start)).To(BeNumerically("~", time.Second, 200*time.Millisecond))
+			Expect(sess.isClosed()).To(BeTrue())
+		})
+
+		It("doesn't read or write after closing", func() {
+			Expect(c.SetLinger(0)).To(Succeed())
+			acceptStream()
+			Expect(c.Close()).To(Succeed())
+			_, err := c.Read(make([]byte, 1))
+			Expect(unwrapOpError(err, "read")).To(MatchError(ErrClosed))
+			_, err = c.Write([]byte("foobar"))
+			Expect(unwrapOpError(err, "write")).To(MatchError(ErrClosed))
+		})
+
+		It("rejects error codes that don't fit into 62 bits", func() {
+			err := c.CloseWithError(1<<62, "foobar")
+			Expect(unwrapOpError(err, "close")).To(MatchError(ContainSubstring("exceeds the maximum")))
+			Expect(sess.isClosed()).To(BeFalse())
+			Expect(c.CloseWithError(1<<62-1, "foobar")).To(Succeed())
+			Expect(sess.closedWithCode).To(BeEquivalentTo(1<<62 - 1))
+		})
+
+		It("returns the closed error from a Read that is blocked during Close", func() {
+			acceptStream()
+			str.blockRead = make(chan struct{})
+			str.readErr = errDeadline // the stream returns a deadline error when Close sets the deadline
+			errChan := make(chan error, 1)
+			go func() {
+				_, err := c.Read(make([]byte, 1))
+				errChan <- err
+			}()
+			Consistently(errChan).ShouldNot(Receive())
+			Expect(c.Close()).To(Succeed())
+			close(str.blockRead)
+			var err error
+			Eventually(errChan).Should(Receive(&err))
+			Expect(unwrapOpError(err, "read")).To(MatchError(ErrClosed))
+			Expect(err.(net.Error).Timeout()).To(BeFalse())
+		})
+
+		It("returns the closed error from a Write that is blocked during Close", func() {
+			acceptStream()
+			str.blockWrite = make(chan struct{})
+			str.writeErr = errDeadline
+			errChan := make(chan error, 1)
+			go func() {
+				_, err := c.Write([]byte("foobar"))
+				errChan <- err
+			}()
+			Consistently(errChan).ShouldNot(Receive())
+			Expect(c.CloseWithError(0, "")).To(Succeed())
+			close(str.blockWrite)
+			var err error
+			Eventually(errChan).Should(Receive(&err))
+			Expect(unwrapOpError(err, "write")).To(MatchError(ErrClosed))
+			Expect(err.(net.Error).Timeout()).To(BeFalse())
+		})
+
+		It("closes with an error", func() {
+			Expect(c.CloseWithError(1337, "foobar")).To(Succeed())
+			Expect(sess.isClosed()).To(BeTrue())
+			Expect(sess.closedWithCode).To(BeEquivalentTo(1337))
+			Expect(sess.closedWithError).To(Equal("foobar"))
+			Expect(unwrapOpError(c.CloseWithError(1337, "foobar"), "close")).To(MatchError(ErrClosed))
+		})
+
+		It("returns application errors when reading", func() {
+			acceptStream()
+			str.mutex.Lock()
+			str.readErr = &mockApplicationError{ErrorCode: 42, ErrorMessage: "auth failed"}
+			str.mutex.Unlock()
+			_, err := c.Read(make([]byte, 1))
+			Expect(unwrapOpError(err, "read")).To(Equal(&ApplicationError{Code: 42, Reason: "auth failed"}))
+		})
+
+		It("returns application errors when writing", func() {
+			acceptStream()
+			str.mutex.Lock()
+			str.writeErr = &mockApplicationError{ErrorCode: 42, ErrorMessage: "auth failed"}
+			str.mutex.Unlock()
+			_, err := c.Write([]byte("foobar"))
+			Expect(unwrapOpError(err, "write")).To(Equal(&ApplicationError{Code: 42, Reason: "auth failed"}))
+		})
+
+		It("unblocks a Read waiting for the stream", func() {
+			Expect(c.SetLinger(0)).To(Succeed())
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				_, err := c.Read(make([]byte, 1))
+				Expect(unwrapOpError(err, "read")).To(MatchError(ErrClosed))
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			Expect(c.Close()).To(Succeed())
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("errors when closed twice", func() {
+			Expect(c.SetLinger(0)).To(Succeed())
+			Expect(c.Close()).To(Succeed())
+			Expect(unwrapOpError(c.Close(), "close")).To(MatchError(ErrClosed))
+		})
 	})
 })
@@ -0,0 +1,83 @@
+package quicconn
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+type deadlineError struct{}
+
+func (deadlineError) Error() string   { return "deadline exceeded" }
+func (deadlineError) Temporary() bool { return true }
+func (deadlineError) Timeout() bool   { return true }
+
+var errDeadline net.Error = &deadlineError{}
+
+// A deadline signals the expiry of a point in time by closing a channel.
+// It works like the deadline used by net.Pipe.
+type deadline struct {
+	mutex  sync.Mutex
+	t      time.Time
+	timer  *time.Timer
+	cancel chan struct{} // closed when the deadline expires
+}
+
+func newDeadline() *deadline {
+	return &deadline{cancel: make(chan struct{})}
+}
+
+// set sets the point in time when the deadline will expire.
+// A zero value for t disables the deadline.
+func (d *deadline) set(t time.Time) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.t = t
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.cancel // wait for the timer callback to finish and close cancel
+	}
+	d.timer = nil
+
+	closed := isClosedChan(d.cancel)
+	if t.IsZero() {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+	if dur := time.Until(t); dur > 0 {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		cancel := d.cancel
+		d.timer = time.AfterFunc(dur, func() { close(cancel) })
+		return
+	}
+	if !closed {
+		close(d.cancel)
+	}
+}
+
+// get returns the point in time when the deadline expires.
+func (d *deadline) get() time.Time {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.t
+}
+
+// wait returns a channel that is closed when the deadline expires.
+func (d *deadline) wait() <-chan struct{} {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.cancel
+}
+
+func isClosedChan(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,48 @@
+package quicconn
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Deadline", func() {
+	var d *deadline
+
+	BeforeEach(func() {
+		d = newDeadline()
+	})
+
+	It("doesn't expire without a deadline", func() {
+		Consistently(d.wait()).ShouldNot(BeClosed())
+	})
+
+	It("expires", func() {
+		d.set(time.Now().Add(50 * time.Millisecond))
+		c := d.wait()
+		Consistently(c, 30*time.Millisecond).ShouldNot(BeClosed())
+		Eventually(c).Should(BeClosed())
+	})
+
+	It("expires immediately when the deadline is in the past", func() {
+		d.set(time.Now().Add(-time.Second))
+		Expect(d.wait()).To(BeClosed())
+	})
+
+	It("is reset when the deadline is extended", func() {
+		d.set(time.Now().Add(-time.Second))
+		Expect(d.wait()).To(BeClosed())
+		d.set(time.Now().Add(time.Hour))
+		Expect(d.wait()).ToNot(BeClosed())
+	})
+
+	It("is disabled with a zero deadline", func() {
+		t := time.Now().Add(50 * time.Millisecond)
+		d.set(t)
+		Expect(d.get()).To(Equal(t))
+		d.set(time.Time{})
+		Expect(d.get()).To(BeZero())
+		Consistently(d.wait(), 100*time.Millisecond).ShouldNot(BeClosed())
+	})
+})
@@ -1,50 +1,81 @@
 package quicconn
 
 import (
+	"context"
 	"crypto/tls"
 	"net"
 
 	quic "github.com/lucas-clemente/quic-go"
 )
 
+// DefaultNextProto is the application protocol negotiated using ALPN,
+// if no NextProtos are set in the tls.Config.
+// QUIC requires the peers to negotiate an application protocol.
+const DefaultNextProto = "quic-conn"
+
 var quicListen = quic.Listen
 
 // Listen creates a QUIC listener on the given network interface
-func Listen(network, laddr string, tlsConfig *tls.Config) (net.Listener, error) {
-	udpAddr, err := net.ResolveUDPAddr(network, laddr)
-	if err != nil {
-		return nil, &net.OpError{Op: "listen", Net: network, Source: nil, Addr: nil, Err: err}
-	}
-	conn, err := net.ListenUDP(network, udpAddr)
-	if err != nil {
-		return nil, err
-	}
+// The UDP socket is closed when the listener is closed.
+// Errors are returned as a *net.OpError.
+// Use a ListenConfig to configure QUIC.
+// If no NextProtos are set in the tls.Config, DefaultNextProto is used.
+// Unless SessionTicketsDisabled is set in the tls.Config, the listener issues session tickets,
+// allowing clients to resume the TLS session.
+// Tickets are encrypted using the SessionTicketKey of the tls.Config, which is chosen randomly if unset.
+// Listeners sharing the same key accept each other's tickets.
+func Listen(network, laddr string, tlsConfig *tls.Config) (*Listener, error) {
+	lc := &ListenConfig{TLSConfig: tlsConfig}
+	return lc.listen(context.Background(), network, laddr)
+}
 
-	ln, err := quicListen(conn, tlsConfig, nil)
-	if err != nil {
-		return nil, err
-	}
-	return &server{
-		quicServer: ln,
-	}, nil
+// ListenPacket creates a QUIC listener using an existing net.PacketConn.
+// The PacketConn is owned by the caller, and is not closed when the listener is closed.
+// See ListenConfig.ListenPacket for details.
+func ListenPacket(pconn net.PacketConn, tlsConfig *tls.Config) (*Listener, error) {
+	lc := &ListenConfig{TLSConfig: tlsConfig}
+	return lc.listenPacket(pconn)
 }
 
 // Dial creates a new QUIC connection
 // it returns once the connection is established and secured with forward-secure keys
-func Dial(addr string, tlsConfig *tls.Config) (net.Conn, error) {
-	// DialAddr returns once a forward-secure connection is established
-	quicSession, err := quic.DialAddr(addr, tlsConfig, nil)
-	if err != nil {
-		return nil, err
-	}
+// Errors are returned as a *net.OpError.
+// If no NextProtos are set in the tls.Config, DefaultNextProto is used.
+// If the server doesn't support any of the protocols, a *NoApplicationProtocolError is returned.
+// TLS sessions are only resumed if a ClientSessionCache is set in the tls.Config.
+// Use a Dialer to resume sessions using a default cache.
+func Dial(addr string, tlsConfig *tls.Config) (*Conn, error) {
+	return DialContext(context.Background(), addr, tlsConfig)
+}
 
-	sendStream, err := quicSession.OpenStream()
-	if err != nil {
-		return nil, err
-	}
+// DialContext creates a new QUIC connection using the provided context.
+// If the context is canceled or expires before the connection is established,
+// resolving the address, the handshake and opening the stream are aborted,
+// and the context's error is returned wrapped in a *net.OpError.
+// Once the connection is established, the context doesn't affect it.
+// Like Dial, it only resumes TLS sessions if a ClientSessionCache is set in the tls.Config.
+func DialContext(ctx context.Context, addr string, tlsConfig *tls.Config) (*Conn, error) {
+	d := &Dialer{TLSConfig: tlsConfig, noDefaultSessionCache: true}
+	return d.dialContext(ctx, "udp", addr)
+}
 
-	return &conn{
-		session:    quicSession,
-		sendStream: sendStream,
-	}, nil
+// DialPacketConn creates a new QUIC connection to raddr, using an existing net.PacketConn.
+// The host is used for SNI, unless ServerName is set in the tls.Config.
+// The PacketConn is owned by the caller, and is not closed when the connection is closed.
+// TLS sessions are only resumed if a ClientSessionCache is set in the tls.Config.
+// See Dialer.DialPacketConn for details.
+func DialPacketConn(ctx context.Context, pconn net.PacketConn, raddr net.Addr, host string, tlsConfig *tls.Config) (*Conn, error) {
+	d := &Dialer{TLSConfig: tlsConfig, noDefaultSessionCache: true}
+	return d.dialPacketConn(ctx, pconn, raddr, host)
+}
+
+// withDefaultNextProto returns a tls.Config that uses DefaultNextProto, if no NextProtos are set.
+// The config passed in is not modified.
+func withDefaultNextProto(conf *tls.Config) *tls.Config {
+	if conf == nil || len(conf.NextProtos) > 0 {
+		return conf
+	}
+	conf = conf.Clone()
+	conf.NextProtos = []string{DefaultNextProto}
+	return conf
 }
@@ -1,15 +1,38 @@
 package quicconn
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"math/big"
 	"net"
+	"time"
 
 	quic "github.com/lucas-clemente/quic-go"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
 
+// generateTLSConfig generates a tls.Config with a self-signed certificate
+func generateTLSConfig() *tls.Config {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	Expect(err).ToNot(HaveOccurred())
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	Expect(err).ToNot(HaveOccurred())
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{certDER}, PrivateKey: key}},
+		NextProtos:   []string{"quic-conn"},
+	}
+}
+
 var _ = Describe("Dial and Listen", func() {
 	AfterEach(func() {
 		quicListen = quic.Listen
@@ -18,7 +41,7 @@ var _ = Describe("Dial and Listen", func() {
 	It("listens", func() {
 		var conn net.PacketConn
 		var tlsConfig *tls.Config
-		tlsConf := &tls.Config{}
+		tlsConf := &tls.Config{NextProtos: []string{"foo"}}
 		quicListen = func(c net.PacketConn, tlsConf *tls.Config, _ *quic.Config) (quic.Listener, error) {
 			conn = c
 			tlsConfig = tlsConf
@@ -30,12 +53,139 @@ var _ = Describe("Dial and Listen", func() {
 		Expect(tlsConfig).To(Equal(tlsConf))
 	})
 
+	It("dials", func() {
+		tlsConf := generateTLSConfig()
+		ln, err := Listen("udp", "localhost:0", tlsConf)
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+		c, err := DialContext(context.Background(), ln.Addr().String(), &tls.Config{
+			InsecureSkipVerify: true,
+			NextProtos:         []string{"quic-conn"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c.RemoteAddr().String()).To(Equal(ln.Addr().String()))
+		Expect(c.CloseWithError(0, "")).To(Succeed())
+	})
+
+	It("aborts the handshake when the context is canceled", func() {
+		// the server never answers
+		udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		Expect(err).ToNot(HaveOccurred())
+		defer udpConn.Close()
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			cancel()
+		}()
+		start := time.Now()
+		_, err = DialContext(ctx, udpConn.LocalAddr().String(), &tls.Config{})
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		Expect(unwrapOpError(err, "dial")).To(MatchError(context.Canceled))
+		Expect(err.(*net.OpError).Addr.String()).To(Equal(udpConn.LocalAddr().String()))
+	})
+
+	It("returns a timeout error when the context expires", func() {
+		udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		Expect(err).ToNot(HaveOccurred())
+		defer udpConn.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err = DialContext(ctx, udpConn.LocalAddr().String(), &tls.Config{})
+		Expect(unwrapOpError(err, "dial")).To(MatchError(context.DeadlineExceeded))
+		Expect(err.(net.Error).Timeout()).To(BeTrue())
+	})
+
+	It("aborts resolving the address when the context is canceled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := DialContext(ctx, "quic.invalid:443", &tls.Config{})
+		Expect(unwrapOpError(err, "dial")).To(HaveOccurred())
+		Expect(err.(*net.OpError).Addr).To(BeNil())
+	})
+
+	It("uses the default application protocol", func() {
+		var tlsConfig *tls.Config
+		tlsConf := &tls.Config{ServerName: "foo"}
+		quicListen = func(_ net.PacketConn, tlsConf *tls.Config, _ *quic.Config) (quic.Listener, error) {
+			tlsConfig = tlsConf
+			return nil, nil
+		}
+		_, err := Listen("udp", "localhost:0", tlsConf)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tlsConfig.NextProtos).To(Equal([]string{DefaultNextProto}))
+		Expect(tlsConfig.ServerName).To(Equal("foo"))
+		Expect(tlsConf.NextProtos).To(BeEmpty())
+	})
+
 	It("returns listen errors", func() {
 		testErr := errors.New("listen error")
 		quicListen = func(_ net.PacketConn, _ *tls.Config, _ *quic.Config) (quic.Listener, error) {
 			return nil, testErr
 		}
 		_, err := Listen("udp", "localhost:12346", &tls.Config{})
-		Expect(err).To(MatchError(testErr))
+		Expect(unwrapOpError(err, "listen")).To(MatchError(testErr))
+		Expect(err.(*net.OpError).Addr.String()).To(Equal("127.0.0.1:12346"))
+	})
+
+	It("closes the socket when the listener is closed", func() {
+		ln, err := Listen("udp", "127.0.0.1:0", generateTLSConfig())
+		Expect(err).ToNot(HaveOccurred())
+		addr := ln.Addr().(*net.UDPAddr)
+		Expect(ln.Close()).To(Succeed())
+		conn, err := net.ListenUDP("udp", addr)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(conn.Close()).To(Succeed())
+	})
+
+	Context("listening on an existing PacketConn", func() {
+		var pconn *net.UDPConn
+
+		BeforeEach(func() {
+			var err error
+			pconn, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("accepts connections", func() {
+			ln, err := ListenPacket(pconn, generateTLSConfig())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ln.Addr()).To(Equal(pconn.LocalAddr()))
+			go func() {
+				defer GinkgoRecover()
+				c, err := DialContext(context.Background(), ln.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(c.Close()).To(Succeed())
+			}()
+			c, err := ln.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.(*Conn).CloseWithError(0, "")).To(Succeed())
+			Expect(ln.Close()).To(Succeed())
+			Expect(pconn.Close()).To(Succeed())
+		})
+
+		It("doesn't close the PacketConn when the listener is closed", func() {
+			ln, err := ListenPacket(pconn, generateTLSConfig())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ln.Close()).To(Succeed())
+			_, err = pconn.WriteTo([]byte("foobar"), pconn.LocalAddr())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pconn.Close()).To(Succeed())
+		})
+
+		It("doesn't close the PacketConn if listening fails", func() {
+			testErr := errors.New("listen error")
+			quicListen = func(net.PacketConn, *tls.Config, *quic.Config) (quic.Listener, error) {
+				return nil, testErr
+			}
+			_, err := ListenPacket(pconn, &tls.Config{})
+			Expect(unwrapOpError(err, "listen")).To(MatchError(testErr))
+			Expect(err.(*net.OpError).Addr).To(Equal(pconn.LocalAddr()))
+			Expect(pconn.Close()).To(Succeed())
+		})
+	})
+
+	It("returns resolve errors", func() {
+		_, err := Listen("udp", "localhost:foobar", &tls.Config{})
+		Expect(unwrapOpError(err, "listen")).To(HaveOccurred())
 	})
 })
@@ -0,0 +1,485 @@
+package quicconn
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+)
+
+// defaultFallbackDelay is the delay between starting handshakes to different addresses,
+// as recommended by RFC 8305.
+const defaultFallbackDelay = 250 * time.Millisecond
+
+// A Dialer contains options for connecting to an address.
+// It mirrors net.Dialer.
+//
+// The zero value for each field is equivalent to dialing without that option,
+// unless noted otherwise.
+// A Dialer must not be copied after first use.
+type Dialer struct {
+	// Timeout is the maximum amount of time a dial will wait for a connection to be established,
+	// including name resolution, the handshake and opening the stream.
+	// If Deadline is also set, it may fail earlier.
+	Timeout time.Duration
+
+	// Deadline is the absolute point in time after which dials will fail.
+	// If Timeout is also set, it may fail earlier.
+	Deadline time.Time
+
+	// LocalAddr is the local address to use when dialing.
+	// It must be a *net.UDPAddr.
+	// If nil, a local address is automatically chosen.
+	LocalAddr net.Addr
+
+	// Interface is the name of the network interface to use when dialing, for example "eth0".
+	// Packets are sent and received on this interface only, regardless of the routing table.
+	// It can be combined with LocalAddr to choose the source address on this interface.
+	// Binding to an interface is only supported on Linux (using SO_BINDTODEVICE),
+	// and, depending on the kernel version, requires the CAP_NET_RAW capability.
+	// It is not used by DialPacketConn.
+	Interface string
+
+	// FallbackDelay specifies the length of time to wait before starting a handshake
+	// to the next address, if the host resolves to multiple addresses (Happy Eyeballs, RFC 8305).
+	// A handshake is also started as soon as the previous one failed.
+	// If zero, a default delay of 250ms is used.
+	// A negative value disables racing, and the addresses are dialed one after another.
+	FallbackDelay time.Duration
+
+	// Retry configures retrying failed dials.
+	// If nil, dials are not retried.
+	Retry *RetryPolicy
+
+	// KeepAlive enables sending keep-alive packets,
+	// so that the connection is not closed when it is idle.
+	// QUIC doesn't allow configuring the keep-alive period.
+	// If set, it overrides the KeepAlive field of QUICConfig.
+	KeepAlive bool
+
+	// TLSConfig is the TLS configuration used for the handshake.
+	// If ServerName is empty, the host name of the address is used.
+	// If NextProtos is empty, DefaultNextProto is used.
+	// The config is not modified.
+	TLSConfig *tls.Config
+
+	// CertificatePins and PublicKeyPins pin the certificate of the server.
+	// If any pins are set, the server's leaf certificate must either match one of the CertificatePins,
+	// or its public key one of the PublicKeyPins, otherwise dialing fails with a *PinMismatchError.
+	// The certificate chain, the host name and the expiry of the certificate are not verified then,
+	// as if InsecureSkipVerify was set in the TLSConfig.
+	// VerifyPeerCertificate of the TLSConfig is still called after checking the pins.
+	CertificatePins []Pin
+	PublicKeyPins   []Pin
+
+	// ClientSessionCache is the cache of TLS sessions used for session resumption.
+	// It is only used if TLSConfig doesn't set a ClientSessionCache.
+	// If nil, an in-memory LRU cache is used, which is shared by all dials of this Dialer.
+	// Session resumption is disabled by setting SessionTicketsDisabled in the TLSConfig.
+	ClientSessionCache tls.ClientSessionCache
+
+	// QUICConfig is the QUIC configuration.
+	// If nil, the default configuration of quic-go is used.
+	QUICConfig *quic.Config
+
+	// Resolver optionally specifies an alternate resolver to use.
+	Resolver *net.Resolver
+
+	// If Control is not nil, it is called after creating the UDP socket,
+	// but before binding it, see net.Dialer.
+	Control func(network, address string, c syscall.RawConn) error
+
+	// noDefaultSessionCache is set by the package-level dial functions,
+	// since a default cache wouldn't be reused by any other dial.
+	noDefaultSessionCache bool
+
+	mutex               sync.Mutex // protects defaultSessionCache
+	defaultSessionCache tls.ClientSessionCache
+}
+
+// Dial connects to the address on the named network.
+// Known networks are "udp", "udp4" (IPv4-only) and "udp6" (IPv6-only).
+// The networks "tcp", "tcp4" and "tcp6" are accepted as aliases of the respective UDP networks,
+// since users of net.Conn like http.Transport always dial TCP networks.
+// If the host resolves to multiple addresses, handshakes are raced,
+// alternating between IPv6 and IPv4 addresses, see FallbackDelay.
+// The connection is a *Conn.
+// Errors are returned as a *net.OpError.
+func (d *Dialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+// DialContext connects to the address on the named network using the provided context.
+// It can be used as the DialContext function of http.Transport and similar,
+// which dial the "tcp" network.
+// If the context is canceled or expires before the connection is established,
+// resolving the address, the handshake and opening the stream are aborted.
+// Once the connection is established, the context doesn't affect it.
+// See Dial for a description of the network and address parameters.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	c, err := d.dialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (d *Dialer) dialContext(ctx context.Context, network, address string) (*Conn, error) {
+	switch network {
+	case "udp", "udp4", "udp6":
+	case "tcp", "tcp4", "tcp6":
+		network = "udp" + strings.TrimPrefix(network, "tcp")
+	default:
+		return nil, newOpError("dial", d.LocalAddr, nil, net.UnknownNetworkError(network))
+	}
+	if deadline := d.deadline(ctx, time.Now()); !deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	return d.withRetries(ctx, func(ctx context.Context) (*Conn, error) {
+		raddrs, err := d.resolve(ctx, network, address)
+		if err != nil {
+			return nil, newOpError("dial", d.LocalAddr, nil, err)
+		}
+		return d.dialParallel(ctx, network, raddrs, address)
+	})
+}
+
+// withRetries calls dial, and retries according to the RetryPolicy, if set.
+func (d *Dialer) withRetries(ctx context.Context, dial func(context.Context) (*Conn, error)) (*Conn, error) {
+	if d.Retry == nil {
+		return dial(ctx)
+	}
+	return d.Retry.do(ctx, dial)
+}
+
+// dialParallel races handshakes to the addresses, as described in RFC 8305 (Happy Eyeballs).
+// A new handshake is started every FallbackDelay, or as soon as the previous one failed.
+// The first connection established is returned, and all other handshakes are aborted.
+// If all handshakes fail, the first error is returned.
+func (d *Dialer) dialParallel(ctx context.Context, network string, raddrs []*net.UDPAddr, address string) (*Conn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type dialResult struct {
+		conn *Conn
+		err  error
+	}
+	results := make(chan dialResult, len(raddrs))
+	var next, pending int
+	startDial := func() {
+		raddr := raddrs[next]
+		next++
+		pending++
+		go func() {
+			c, err := d.dialAddr(ctx, network, raddr, address)
+			results <- dialResult{conn: c, err: err}
+		}()
+	}
+
+	// If racing is disabled, the timer never fires.
+	delay := d.fallbackDelay()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	timerC := timer.C
+	if delay < 0 {
+		timerC = nil
+	}
+	startDial()
+
+	var firstErr error
+	for {
+		select {
+		case <-timerC:
+			if next < len(raddrs) {
+				startDial()
+				timer.Reset(delay)
+			}
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				// Close connections that were established before the handshakes were aborted.
+				go func(pending int) {
+					for i := 0; i < pending; i++ {
+						if res := <-results; res.err == nil {
+							res.conn.CloseWithError(ErrorCodeNoError, "")
+						}
+					}
+				}(pending)
+				return res.conn, nil
+			}
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			if next < len(raddrs) {
+				startDial()
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(delay)
+			} else if pending == 0 {
+				return nil, firstErr
+			}
+		}
+	}
+}
+
+// dialAddr establishes a connection to a single address, using a new UDP socket.
+// The socket is closed when the connection is closed.
+func (d *Dialer) dialAddr(ctx context.Context, network string, raddr *net.UDPAddr, address string) (*Conn, error) {
+	pconn, err := d.listenPacket(ctx, network)
+	if err != nil {
+		return nil, newOpError("dial", d.LocalAddr, raddr, err)
+	}
+	c, err := d.dialPacketConn(ctx, pconn, raddr, address)
+	if err != nil {
+		pconn.Close()
+		return nil, err
+	}
+	// Unlike DialAddr, DialContext doesn't close the UDP connection when the session is closed.
+	go func() {
+		<-c.Context().Done()
+		pconn.Close()
+	}()
+	return c, nil
+}
+
+// DialPacketConn establishes a connection to raddr, using an existing net.PacketConn.
+// This allows choosing the local port, or using a socket that was used for NAT hole punching.
+// The host is used for SNI, unless ServerName is set in the TLSConfig.
+// LocalAddr, Resolver, FallbackDelay and Control are not used.
+//
+// The PacketConn is owned by the caller, and is not closed when the connection is closed.
+// It can be used for multiple connections at the same time,
+// since QUIC packets are demultiplexed using the connection IDs.
+// The caller must not read from the PacketConn, and must not close it
+// before all connections using it are closed. Closing it closes these connections.
+func (d *Dialer) DialPacketConn(ctx context.Context, pconn net.PacketConn, raddr net.Addr, host string) (net.Conn, error) {
+	if deadline := d.deadline(ctx, time.Now()); !deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+	c, err := d.withRetries(ctx, func(ctx context.Context) (*Conn, error) {
+		return d.dialPacketConn(ctx, pconn, raddr, host)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (d *Dialer) dialPacketConn(ctx context.Context, pconn net.PacketConn, raddr net.Addr, host string) (*Conn, error) {
+	tlsConf := d.tlsConfig()
+	var pinErr error
+	if len(d.CertificatePins) > 0 || len(d.PublicKeyPins) > 0 {
+		verify := tlsConf.VerifyPeerCertificate
+		tlsConf.InsecureSkipVerify = true
+		tlsConf.VerifyPeerCertificate = func(rawCerts [][]byte, chains [][]*x509.Certificate) error {
+			if err := verifyPins(d.CertificatePins, d.PublicKeyPins, rawCerts); err != nil {
+				pinErr = err
+				return err
+			}
+			if verify != nil {
+				return verify(rawCerts, chains)
+			}
+			return nil
+		}
+	}
+	// DialContext returns once a forward-secure connection is established
+	sess, err := quic.DialContext(ctx, pconn, raddr, host, tlsConf, d.quicConfig())
+	if err != nil {
+		switch {
+		case pinErr != nil:
+			if perr, ok := pinErr.(*PinMismatchError); ok {
+				perr.err = err
+			}
+			err = pinErr
+		case isTLSAlert(err, tlsAlertNoApplicationProtocol):
+			err = &NoApplicationProtocolError{NextProtos: tlsConf.NextProtos, err: err}
+		}
+		return nil, newOpError("dial", pconn.LocalAddr(), raddr, err)
+	}
+	c, err := newClientConn(ctx, sess)
+	if err != nil {
+		sess.Close()
+		return nil, newOpError("dial", pconn.LocalAddr(), raddr, err)
+	}
+	return c, nil
+}
+
+func (d *Dialer) fallbackDelay() time.Duration {
+	if d.FallbackDelay == 0 {
+		return defaultFallbackDelay
+	}
+	return d.FallbackDelay
+}
+
+// deadline returns the earliest of:
+//   - now+Timeout
+//   - d.Deadline
+//   - the context's deadline
+//
+// Or zero, if none of Timeout, Deadline, or context's deadline is set.
+func (d *Dialer) deadline(ctx context.Context, now time.Time) time.Time {
+	var earliest time.Time
+	if d.Timeout != 0 {
+		earliest = now.Add(d.Timeout)
+	}
+	if !d.Deadline.IsZero() && (earliest.IsZero() || d.Deadline.Before(earliest)) {
+		earliest = d.Deadline
+	}
+	if deadline, ok := ctx.Deadline(); ok && (earliest.IsZero() || deadline.Before(earliest)) {
+		earliest = deadline
+	}
+	return earliest
+}
+
+// tlsConfig returns the TLS configuration used for a handshake.
+// It returns a clone of TLSConfig, since quic-go sets the ServerName on the config.
+func (d *Dialer) tlsConfig() *tls.Config {
+	conf := &tls.Config{}
+	if d.TLSConfig != nil {
+		conf = d.TLSConfig.Clone()
+	}
+	if conf.ClientSessionCache == nil && !conf.SessionTicketsDisabled {
+		conf.ClientSessionCache = d.sessionCache()
+	}
+	if len(conf.NextProtos) == 0 {
+		conf.NextProtos = []string{DefaultNextProto}
+	}
+	return conf
+}
+
+func (d *Dialer) sessionCache() tls.ClientSessionCache {
+	if d.ClientSessionCache != nil || d.noDefaultSessionCache {
+		return d.ClientSessionCache
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.defaultSessionCache == nil {
+		d.defaultSessionCache = tls.NewLRUClientSessionCache(0)
+	}
+	return d.defaultSessionCache
+}
+
+func (d *Dialer) quicConfig() *quic.Config {
+	if !d.KeepAlive {
+		return d.QUICConfig
+	}
+	conf := &quic.Config{}
+	if d.QUICConfig != nil {
+		*conf = *d.QUICConfig
+	}
+	conf.KeepAlive = true
+	return conf
+}
+
+// listenPacket creates the UDP socket used for the connection.
+func (d *Dialer) listenPacket(ctx context.Context, network string) (net.PacketConn, error) {
+	var laddr string
+	if d.LocalAddr != nil {
+		udpAddr, ok := d.LocalAddr.(*net.UDPAddr)
+		if !ok {
+			return nil, &net.AddrError{Err: "mismatched local address type", Addr: d.LocalAddr.String()}
+		}
+		laddr = udpAddr.String()
+	}
+	lc := &net.ListenConfig{Control: d.control}
+	return lc.ListenPacket(ctx, network, laddr)
+}
+
+// control binds the socket to the Interface, if set, and then calls the Control function.
+func (d *Dialer) control(network, address string, c syscall.RawConn) error {
+	if len(d.Interface) > 0 {
+		if err := bindToDevice(c, d.Interface); err != nil {
+			return err
+		}
+	}
+	if d.Control != nil {
+		return d.Control(network, address, c)
+	}
+	return nil
+}
+
+// resolve resolves a UDP address like net.ResolveUDPAddr does,
+// using the Resolver and aborting when the context is canceled.
+// Only addresses of the address family of the network and the local address are returned.
+// The addresses are sorted in the order in which they should be dialed,
+// alternating between IPv6 and IPv4 addresses, as described in RFC 8305.
+func (d *Dialer) resolve(ctx context.Context, network, address string) ([]*net.UDPAddr, error) {
+	resolver := d.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	portnum, err := resolver.LookupPort(ctx, network, port)
+	if err != nil {
+		return nil, err
+	}
+	if host == "" {
+		return []*net.UDPAddr{{Port: portnum}}, nil
+	}
+	ips, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if laddr, ok := d.LocalAddr.(*net.UDPAddr); ok && network == "udp" && laddr.IP != nil && !laddr.IP.IsUnspecified() {
+		network = "udp6"
+		if laddr.IP.To4() != nil {
+			network = "udp4"
+		}
+	}
+	var addrs []*net.UDPAddr
+	for _, ip := range ips {
+		switch {
+		case network == "udp4" && ip.IP.To4() == nil:
+		case network == "udp6" && ip.IP.To4() != nil:
+		default:
+			addrs = append(addrs, &net.UDPAddr{IP: ip.IP, Port: portnum, Zone: ip.Zone})
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, &net.AddrError{Err: "no suitable address found", Addr: host}
+	}
+	return interleaveAddrs(addrs), nil
+}
+
+// interleaveAddrs sorts the addresses such that IPv6 and IPv4 addresses alternate.
+// The first address is kept, so the address family preferred by the resolver is tried first.
+// Within each address family, the order is preserved.
+func interleaveAddrs(addrs []*net.UDPAddr) []*net.UDPAddr {
+	var first, second []*net.UDPAddr
+	isIPv4 := addrs[0].IP.To4() != nil
+	for _, addr := range addrs {
+		if (addr.IP.To4() != nil) == isIPv4 {
+			first = append(first, addr)
+		} else {
+			second = append(second, addr)
+		}
+	}
+	sorted := make([]*net.UDPAddr, 0, len(addrs))
+	for i := 0; i < len(first) || i < len(second); i++ {
+		if i < len(first) {
+			sorted = append(sorted, first[i])
+		}
+		if i < len(second) {
+			sorted = append(sorted, second[i])
+		}
+	}
+	return sorted
+}
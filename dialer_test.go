@@ -0,0 +1,424 @@
+package quicconn
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Dialer", func() {
+	var (
+		ln            net.Listener
+		clientTLSConf *tls.Config
+	)
+
+	BeforeEach(func() {
+		var err error
+		ln, err = Listen("udp", "127.0.0.1:0", generateTLSConfig())
+		Expect(err).ToNot(HaveOccurred())
+		clientTLSConf = &tls.Config{
+			InsecureSkipVerify: true,
+			NextProtos:         []string{"quic-conn"},
+		}
+	})
+
+	AfterEach(func() {
+		Expect(ln.Close()).To(Succeed())
+	})
+
+	It("dials", func() {
+		d := &Dialer{TLSConfig: clientTLSConf}
+		c, err := d.Dial("udp", ln.Addr().String())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c).To(BeAssignableToTypeOf(&Conn{}))
+		Expect(c.RemoteAddr().String()).To(Equal(ln.Addr().String()))
+		Expect(c.(*Conn).CloseWithError(0, "")).To(Succeed())
+	})
+
+	It("doesn't modify the tls.Config", func() {
+		d := &Dialer{TLSConfig: clientTLSConf}
+		c, err := d.DialContext(context.Background(), "udp4", ln.Addr().String())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(clientTLSConf.ServerName).To(BeEmpty())
+		Expect(c.(*Conn).CloseWithError(0, "")).To(Succeed())
+	})
+
+	It("uses the default application protocol", func() {
+		Expect((&Dialer{}).tlsConfig().NextProtos).To(Equal([]string{DefaultNextProto}))
+		d := &Dialer{TLSConfig: &tls.Config{NextProtos: []string{"foo", "bar"}}}
+		Expect(d.tlsConfig().NextProtos).To(Equal([]string{"foo", "bar"}))
+	})
+
+	It("returns an error if ALPN fails", func() {
+		clientTLSConf.NextProtos = []string{"foo", "bar"}
+		d := &Dialer{TLSConfig: clientTLSConf}
+		_, err := d.Dial("udp", ln.Addr().String())
+		Expect(unwrapOpError(err, "dial")).To(BeAssignableToTypeOf(&NoApplicationProtocolError{}))
+		Expect(err.(*net.OpError).Err.(*NoApplicationProtocolError).NextProtos).To(Equal([]string{"foo", "bar"}))
+	})
+
+	It("uses the local address", func() {
+		udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		Expect(err).ToNot(HaveOccurred())
+		laddr := udpConn.LocalAddr().(*net.UDPAddr)
+		Expect(udpConn.Close()).To(Succeed())
+		d := &Dialer{TLSConfig: clientTLSConf, LocalAddr: laddr}
+		c, err := d.Dial("udp", ln.Addr().String())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c.LocalAddr().String()).To(Equal(laddr.String()))
+		Expect(c.(*Conn).CloseWithError(0, "")).To(Succeed())
+	})
+
+	It("calls the Control function", func() {
+		var network string
+		d := &Dialer{
+			TLSConfig: clientTLSConf,
+			Control: func(n, _ string, _ syscall.RawConn) error {
+				network = n
+				return nil
+			},
+		}
+		c, err := d.Dial("udp4", ln.Addr().String())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(network).To(Equal("udp4"))
+		Expect(c.(*Conn).CloseWithError(0, "")).To(Succeed())
+	})
+
+	It("returns errors from the Control function", func() {
+		testErr := errors.New("control error")
+		d := &Dialer{
+			TLSConfig: clientTLSConf,
+			Control:   func(string, string, syscall.RawConn) error { return testErr },
+		}
+		_, err := d.Dial("udp", ln.Addr().String())
+		Expect(unwrapOpError(err, "dial")).To(MatchError(testErr))
+	})
+
+	It("uses the Resolver", func() {
+		testErr := errors.New("resolver error")
+		var called bool
+		d := &Dialer{
+			TLSConfig: clientTLSConf,
+			Resolver: &net.Resolver{
+				PreferGo: true,
+				Dial: func(context.Context, string, string) (net.Conn, error) {
+					called = true
+					return nil, testErr
+				},
+			},
+		}
+		_, err := d.Dial("udp", "quic-conn.invalid:443")
+		Expect(unwrapOpError(err, "dial")).To(HaveOccurred())
+		Expect(called).To(BeTrue())
+	})
+
+	Context("certificate pinning", func() {
+		var (
+			pinnedLn net.Listener
+			cert     *x509.Certificate
+		)
+
+		BeforeEach(func() {
+			tlsConf := generateTLSConfig()
+			var err error
+			cert, err = x509.ParseCertificate(tlsConf.Certificates[0].Certificate[0])
+			Expect(err).ToNot(HaveOccurred())
+			pinnedLn, err = Listen("udp", "127.0.0.1:0", tlsConf)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(pinnedLn.Close()).To(Succeed())
+		})
+
+		It("dials if the certificate matches a pin", func() {
+			d := &Dialer{CertificatePins: []Pin{CertificatePin(cert)}}
+			c, err := d.Dial("udp", pinnedLn.Addr().String())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.(*Conn).CloseWithError(0, "")).To(Succeed())
+		})
+
+		It("dials if the public key matches a pin", func() {
+			d := &Dialer{PublicKeyPins: []Pin{{}, PublicKeyPin(cert)}}
+			c, err := d.Dial("udp", pinnedLn.Addr().String())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.(*Conn).CloseWithError(0, "")).To(Succeed())
+		})
+
+		It("returns an error if the certificate doesn't match", func() {
+			d := &Dialer{
+				CertificatePins: []Pin{PublicKeyPin(cert)},
+				PublicKeyPins:   []Pin{CertificatePin(cert)},
+			}
+			_, err := d.Dial("udp", pinnedLn.Addr().String())
+			perr := unwrapOpError(err, "dial")
+			Expect(perr).To(BeAssignableToTypeOf(&PinMismatchError{}))
+			Expect(perr.(*PinMismatchError).CertificatePin).To(Equal(CertificatePin(cert)))
+			Expect(perr.(*PinMismatchError).PublicKeyPin).To(Equal(PublicKeyPin(cert)))
+			Expect(errors.Unwrap(perr)).To(HaveOccurred())
+		})
+
+		It("calls VerifyPeerCertificate", func() {
+			testErr := errors.New("test error")
+			var rawCerts [][]byte
+			d := &Dialer{
+				CertificatePins: []Pin{CertificatePin(cert)},
+				TLSConfig: &tls.Config{
+					VerifyPeerCertificate: func(certs [][]byte, _ [][]*x509.Certificate) error {
+						rawCerts = certs
+						return testErr
+					},
+				},
+			}
+			_, err := d.Dial("udp", pinnedLn.Addr().String())
+			Expect(unwrapOpError(err, "dial")).To(HaveOccurred())
+			Expect(rawCerts).To(Equal([][]byte{cert.Raw}))
+			Expect(d.TLSConfig.InsecureSkipVerify).To(BeFalse())
+		})
+	})
+
+	Context("dialing over an existing PacketConn", func() {
+		var pconn net.PacketConn
+
+		BeforeEach(func() {
+			var err error
+			pconn, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(pconn.Close()).To(Succeed())
+		})
+
+		It("dials", func() {
+			d := &Dialer{TLSConfig: clientTLSConf}
+			c, err := d.DialPacketConn(context.Background(), pconn, ln.Addr(), "localhost")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c).To(BeAssignableToTypeOf(&Conn{}))
+			Expect(c.LocalAddr()).To(Equal(pconn.LocalAddr()))
+			Expect(c.RemoteAddr()).To(Equal(ln.Addr()))
+			Expect(c.(*Conn).CloseWithError(0, "")).To(Succeed())
+		})
+
+		It("doesn't close the PacketConn when the connection is closed", func() {
+			c, err := DialPacketConn(context.Background(), pconn, ln.Addr(), "localhost", clientTLSConf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.CloseWithError(0, "")).To(Succeed())
+			Eventually(c.Context().Done()).Should(BeClosed())
+			_, err = pconn.WriteTo([]byte("foobar"), pconn.LocalAddr())
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("dials multiple connections using the same PacketConn", func() {
+			c1, err := DialPacketConn(context.Background(), pconn, ln.Addr(), "localhost", clientTLSConf)
+			Expect(err).ToNot(HaveOccurred())
+			c2, err := DialPacketConn(context.Background(), pconn, ln.Addr(), "localhost", clientTLSConf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c1.CloseWithError(0, "")).To(Succeed())
+			Expect(c2.Context().Done()).ToNot(BeClosed())
+			Expect(c2.CloseWithError(0, "")).To(Succeed())
+		})
+
+		It("times out", func() {
+			udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			Expect(err).ToNot(HaveOccurred())
+			defer udpConn.Close()
+			d := &Dialer{TLSConfig: clientTLSConf, Timeout: 50 * time.Millisecond}
+			_, err = d.DialPacketConn(context.Background(), pconn, udpConn.LocalAddr(), "localhost")
+			Expect(unwrapOpError(err, "dial")).To(MatchError(context.DeadlineExceeded))
+			Expect(err.(*net.OpError).Source).To(Equal(pconn.LocalAddr()))
+			Expect(err.(*net.OpError).Addr).To(Equal(udpConn.LocalAddr()))
+		})
+	})
+
+	It("rejects unknown networks", func() {
+		d := &Dialer{}
+		_, err := d.Dial("unix", ln.Addr().String())
+		Expect(unwrapOpError(err, "dial")).To(MatchError(net.UnknownNetworkError("unix")))
+	})
+
+	It("accepts TCP networks", func() {
+		d := &Dialer{TLSConfig: clientTLSConf}
+		for _, network := range []string{"tcp", "tcp4"} {
+			c, err := d.Dial(network, ln.Addr().String())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.(*Conn).CloseWithError(0, "")).To(Succeed())
+		}
+		_, err := d.Dial("tcp6", ln.Addr().String())
+		Expect(unwrapOpError(err, "dial")).To(BeAssignableToTypeOf(&net.AddrError{}))
+	})
+
+	It("can be used by http.Transport", func() {
+		httpLn, err := Listen("udp", "127.0.0.1:0", generateTLSConfig())
+		Expect(err).ToNot(HaveOccurred())
+		defer httpLn.Close()
+		go http.Serve(httpLn, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Write([]byte("foobar"))
+		}))
+		d := &Dialer{TLSConfig: clientTLSConf}
+		client := &http.Client{Transport: &http.Transport{DialContext: d.DialContext}}
+		defer client.CloseIdleConnections()
+		resp, err := client.Get("http://" + httpLn.Addr().String())
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(body).To(Equal([]byte("foobar")))
+	})
+
+	It("rejects local addresses that are not UDP addresses", func() {
+		d := &Dialer{LocalAddr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}}
+		_, err := d.Dial("udp", ln.Addr().String())
+		Expect(unwrapOpError(err, "dial")).To(BeAssignableToTypeOf(&net.AddrError{}))
+	})
+
+	It("rejects addresses of the wrong address family", func() {
+		d := &Dialer{}
+		_, err := d.Dial("udp6", ln.Addr().String())
+		Expect(unwrapOpError(err, "dial")).To(BeAssignableToTypeOf(&net.AddrError{}))
+	})
+
+	It("times out", func() {
+		udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		Expect(err).ToNot(HaveOccurred())
+		defer udpConn.Close()
+		d := &Dialer{TLSConfig: clientTLSConf, Timeout: 50 * time.Millisecond}
+		start := time.Now()
+		_, err = d.Dial("udp", udpConn.LocalAddr().String())
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		Expect(unwrapOpError(err, "dial")).To(MatchError(context.DeadlineExceeded))
+		Expect(err.(net.Error).Timeout()).To(BeTrue())
+	})
+
+	Context("Happy Eyeballs", func() {
+		var unresponsive *net.UDPConn
+
+		BeforeEach(func() {
+			var err error
+			unresponsive, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(unresponsive.Close()).To(Succeed())
+		})
+
+		It("interleaves IPv6 and IPv4 addresses", func() {
+			v4a := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1)}
+			v4b := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 2)}
+			v4c := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 3)}
+			v6a := &net.UDPAddr{IP: net.ParseIP("2001:db8::1")}
+			v6b := &net.UDPAddr{IP: net.ParseIP("2001:db8::2")}
+			Expect(interleaveAddrs([]*net.UDPAddr{v6a, v6b, v4a, v4b, v4c})).To(Equal([]*net.UDPAddr{v6a, v4a, v6b, v4b, v4c}))
+			Expect(interleaveAddrs([]*net.UDPAddr{v4a, v4b, v6a, v4c})).To(Equal([]*net.UDPAddr{v4a, v6a, v4b, v4c}))
+			Expect(interleaveAddrs([]*net.UDPAddr{v4a})).To(Equal([]*net.UDPAddr{v4a}))
+		})
+
+		It("resolves IP addresses", func() {
+			addrs, err := (&Dialer{}).resolve(context.Background(), "udp", "[::1]:443")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(addrs).To(Equal([]*net.UDPAddr{{IP: net.ParseIP("::1"), Port: 443}}))
+		})
+
+		It("starts a handshake to the next address after the fallback delay", func() {
+			d := &Dialer{TLSConfig: clientTLSConf, FallbackDelay: 50 * time.Millisecond}
+			raddrs := []*net.UDPAddr{unresponsive.LocalAddr().(*net.UDPAddr), ln.Addr().(*net.UDPAddr)}
+			start := time.Now()
+			c, err := d.dialParallel(context.Background(), "udp", raddrs, ln.Addr().String())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+			Expect(c.RemoteAddr().String()).To(Equal(ln.Addr().String()))
+			Expect(c.CloseWithError(0, "")).To(Succeed())
+		})
+
+		It("dials one address after another when racing is disabled", func() {
+			d := &Dialer{TLSConfig: clientTLSConf, FallbackDelay: -1}
+			raddrs := []*net.UDPAddr{unresponsive.LocalAddr().(*net.UDPAddr), ln.Addr().(*net.UDPAddr)}
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			_, err := d.dialParallel(ctx, "udp", raddrs, ln.Addr().String())
+			Expect(unwrapOpError(err, "dial")).To(MatchError(context.DeadlineExceeded))
+			Expect(err.(*net.OpError).Addr.String()).To(Equal(unresponsive.LocalAddr().String()))
+		})
+
+		It("returns the first error if all handshakes fail", func() {
+			unresponsive2, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			Expect(err).ToNot(HaveOccurred())
+			defer unresponsive2.Close()
+			d := &Dialer{TLSConfig: clientTLSConf, FallbackDelay: 10 * time.Millisecond}
+			raddrs := []*net.UDPAddr{unresponsive.LocalAddr().(*net.UDPAddr), unresponsive2.LocalAddr().(*net.UDPAddr)}
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			_, err = d.dialParallel(ctx, "udp", raddrs, ln.Addr().String())
+			Expect(unwrapOpError(err, "dial")).To(MatchError(context.DeadlineExceeded))
+		})
+	})
+
+	It("calculates the deadline", func() {
+		now := time.Now()
+		ctx, cancel := context.WithDeadline(context.Background(), now.Add(time.Minute))
+		defer cancel()
+		Expect((&Dialer{}).deadline(context.Background(), now)).To(BeZero())
+		Expect((&Dialer{}).deadline(ctx, now)).To(Equal(now.Add(time.Minute)))
+		Expect((&Dialer{Timeout: time.Second}).deadline(ctx, now)).To(Equal(now.Add(time.Second)))
+		Expect((&Dialer{Deadline: now.Add(time.Hour)}).deadline(ctx, now)).To(Equal(now.Add(time.Minute)))
+		Expect((&Dialer{Timeout: time.Hour, Deadline: now.Add(time.Second)}).deadline(ctx, now)).To(Equal(now.Add(time.Second)))
+	})
+
+	Context("session resumption", func() {
+		It("uses a default session cache", func() {
+			d := &Dialer{TLSConfig: clientTLSConf}
+			conf := d.tlsConfig()
+			Expect(conf.ClientSessionCache).ToNot(BeNil())
+			Expect(d.tlsConfig().ClientSessionCache).To(BeIdenticalTo(conf.ClientSessionCache))
+			Expect(clientTLSConf.ClientSessionCache).To(BeNil())
+			Expect((&Dialer{}).tlsConfig().ClientSessionCache).ToNot(BeIdenticalTo(conf.ClientSessionCache))
+		})
+
+		It("uses the session cache of the Dialer", func() {
+			cache := tls.NewLRUClientSessionCache(1)
+			d := &Dialer{ClientSessionCache: cache}
+			Expect(d.tlsConfig().ClientSessionCache).To(BeIdenticalTo(cache))
+		})
+
+		It("prefers the session cache of the tls.Config", func() {
+			cache := tls.NewLRUClientSessionCache(1)
+			clientTLSConf.ClientSessionCache = cache
+			d := &Dialer{TLSConfig: clientTLSConf, ClientSessionCache: tls.NewLRUClientSessionCache(1)}
+			Expect(d.tlsConfig().ClientSessionCache).To(BeIdenticalTo(cache))
+		})
+
+		It("doesn't use a default session cache for the package-level dial functions", func() {
+			d := &Dialer{TLSConfig: clientTLSConf, noDefaultSessionCache: true}
+			Expect(d.tlsConfig().ClientSessionCache).To(BeNil())
+			cache := tls.NewLRUClientSessionCache(1)
+			clientTLSConf.ClientSessionCache = cache
+			Expect(d.tlsConfig().ClientSessionCache).To(BeIdenticalTo(cache))
+		})
+
+		It("doesn't use a session cache if session tickets are disabled", func() {
+			clientTLSConf.SessionTicketsDisabled = true
+			d := &Dialer{TLSConfig: clientTLSConf}
+			Expect(d.tlsConfig().ClientSessionCache).To(BeNil())
+		})
+	})
+
+	It("enables keep-alives without modifying the quic.Config", func() {
+		Expect((&Dialer{}).quicConfig()).To(BeNil())
+		Expect((&Dialer{KeepAlive: true}).quicConfig().KeepAlive).To(BeTrue())
+		conf := &quic.Config{HandshakeTimeout: time.Second}
+		d := &Dialer{QUICConfig: conf, KeepAlive: true}
+		Expect(d.quicConfig()).To(Equal(&quic.Config{HandshakeTimeout: time.Second, KeepAlive: true}))
+		Expect(conf.KeepAlive).To(BeFalse())
+	})
+})
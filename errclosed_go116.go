@@ -0,0 +1,11 @@
+//go:build go1.16
+// +build go1.16
+
+package quicconn
+
+import "net"
+
+// ErrClosed is returned by Accept and AcceptContext after the listener was closed,
+// and by operations on a Conn after it was closed.
+// It is net.ErrClosed.
+var ErrClosed = net.ErrClosed
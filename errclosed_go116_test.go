@@ -0,0 +1,17 @@
+//go:build go1.16
+// +build go1.16
+
+package quicconn
+
+import (
+	"net"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ErrClosed", func() {
+	It("is net.ErrClosed", func() {
+		Expect(ErrClosed).To(Equal(net.ErrClosed))
+	})
+})
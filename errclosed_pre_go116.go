@@ -0,0 +1,11 @@
+//go:build !go1.16
+// +build !go1.16
+
+package quicconn
+
+import "errors"
+
+// ErrClosed is returned by Accept and AcceptContext after the listener was closed,
+// and by operations on a Conn after it was closed.
+// Starting with Go 1.16, it is net.ErrClosed.
+var ErrClosed = errors.New("use of closed network connection")
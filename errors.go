@@ -0,0 +1,157 @@
+package quicconn
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+
+	quic "github.com/lucas-clemente/quic-go"
+)
+
+const (
+	// ErrorCodeNoError is the application error code used when closing a connection without an error.
+	ErrorCodeNoError uint64 = 0
+	// ErrorCodeProtocolViolation is the application error code used when the peer violated the protocol,
+	// for example by opening more than one stream.
+	ErrorCodeProtocolViolation uint64 = 1
+)
+
+// maxErrorCode is the largest application error code, since QUIC encodes error codes as 62 bit integers.
+const maxErrorCode uint64 = 1<<62 - 1
+
+// tlsAlertNoApplicationProtocol is the TLS alert sent when ALPN fails, see RFC 7301.
+const tlsAlertNoApplicationProtocol uint8 = 120
+
+// netName is used as the Net field of the *net.OpErrors returned by this package.
+const netName = "quic"
+
+// An UnexpectedStreamError is returned by Read and Write when the peer opened a stream that it was not allowed to open.
+// The stream is reset, and the connection is closed using ErrorCodeProtocolViolation.
+type UnexpectedStreamError struct {
+	StreamID quic.StreamID
+}
+
+func (e *UnexpectedStreamError) Error() string {
+	return fmt.Sprintf("peer opened unexpected stream %d", e.StreamID)
+}
+
+// A NoApplicationProtocolError is returned when dialing, if the peers failed to negotiate
+// an application protocol using ALPN, because the server doesn't support any of the
+// protocols offered by the client.
+type NoApplicationProtocolError struct {
+	// NextProtos are the application protocols offered by the client.
+	NextProtos []string
+
+	err error
+}
+
+func (e *NoApplicationProtocolError) Error() string {
+	return fmt.Sprintf("no application protocol negotiated, offered: %s", strings.Join(e.NextProtos, ", "))
+}
+
+// Unwrap returns the error returned by quic-go.
+func (e *NoApplicationProtocolError) Unwrap() error {
+	return e.err
+}
+
+// A PinMismatchError is returned when dialing, if the certificate of the server
+// doesn't match any of the pins configured in the Dialer.
+type PinMismatchError struct {
+	// CertificatePin is the pin of the server's certificate.
+	CertificatePin Pin
+	// PublicKeyPin is the pin of the public key of the server's certificate.
+	PublicKeyPin Pin
+
+	err error
+}
+
+func (e *PinMismatchError) Error() string {
+	return fmt.Sprintf("certificate doesn't match any pin (certificate %s, public key %s)", e.CertificatePin, e.PublicKeyPin)
+}
+
+// Unwrap returns the error returned by quic-go.
+func (e *PinMismatchError) Unwrap() error {
+	return e.err
+}
+
+// An ApplicationError is returned by Read and Write when the peer closed the connection using CloseWithError.
+type ApplicationError struct {
+	Code   uint64
+	Reason string
+}
+
+func (e *ApplicationError) Error() string {
+	if len(e.Reason) == 0 {
+		return fmt.Sprintf("application error %#x", e.Code)
+	}
+	return fmt.Sprintf("application error %#x: %s", e.Code, e.Reason)
+}
+
+// toApplicationError converts an error returned by quic-go after the session was closed
+// with an application error code.
+// quic-go doesn't export the type of this error, so the code and the reason are read using reflection.
+func toApplicationError(err error) (*ApplicationError, bool) {
+	if aerr, ok := err.(interface{ IsApplicationError() bool }); !ok || !aerr.IsApplicationError() {
+		return nil, false
+	}
+	v := reflect.Indirect(reflect.ValueOf(err))
+	if v.Kind() != reflect.Struct {
+		return nil, false
+	}
+	code := v.FieldByName("ErrorCode")
+	reason := v.FieldByName("ErrorMessage")
+	if code.Kind() != reflect.Uint64 || reason.Kind() != reflect.String {
+		return nil, false
+	}
+	return &ApplicationError{Code: code.Uint(), Reason: reason.String()}, true
+}
+
+// isTLSAlert checks if err is a QUIC crypto error, which is used when the TLS handshake failed,
+// carrying the given TLS alert.
+// quic-go doesn't export the type of this error, so the code is read using reflection.
+func isTLSAlert(err error, alert uint8) bool {
+	if cerr, ok := err.(interface{ IsCryptoError() bool }); !ok || !cerr.IsCryptoError() {
+		return false
+	}
+	v := reflect.Indirect(reflect.ValueOf(err))
+	if v.Kind() != reflect.Struct {
+		return false
+	}
+	code := v.FieldByName("ErrorCode")
+	if code.Kind() != reflect.Uint64 {
+		return false
+	}
+	// crypto errors use the error codes 0x100 to 0x1ff, where the lower byte is the TLS alert
+	return code.Uint() == 0x100+uint64(alert)
+}
+
+// checkErrorCode checks that an application error code can be sent in a QUIC frame.
+func checkErrorCode(code uint64) error {
+	if code > maxErrorCode {
+		return fmt.Errorf("application error code %#x exceeds the maximum of 2^62-1", code)
+	}
+	return nil
+}
+
+// convertError converts errors returned by quic-go to errors exposed by this package.
+func convertError(err error) error {
+	if aerr, ok := toApplicationError(err); ok {
+		return aerr
+	}
+	return err
+}
+
+// newOpError wraps err in a *net.OpError, like the errors returned by the net package.
+// If err already is a *net.OpError, for example when it was returned by the net package, the error wrapped by it is used.
+// io.EOF is returned unchanged.
+func newOpError(op string, source, addr net.Addr, err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+	if operr, ok := err.(*net.OpError); ok {
+		err = operr.Err
+	}
+	return &net.OpError{Op: op, Net: netName, Source: source, Addr: addr, Err: err}
+}
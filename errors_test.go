@@ -0,0 +1,122 @@
+package quicconn
+
+import (
+	"errors"
+	"io"
+	"net"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// mockApplicationError has the same structure as the error that quic-go returns
+// when the session was closed with an application error code
+type mockApplicationError struct {
+	ErrorCode    uint64
+	ErrorMessage string
+}
+
+func (e *mockApplicationError) Error() string            { return e.ErrorMessage }
+func (e *mockApplicationError) IsApplicationError() bool { return true }
+
+// mockCryptoError has the same structure as the error that quic-go returns
+// when the TLS handshake failed
+type mockCryptoError struct {
+	ErrorCode uint64
+}
+
+func (e *mockCryptoError) Error() string       { return "crypto error" }
+func (e *mockCryptoError) IsCryptoError() bool { return true }
+
+// unwrapOpError checks that err is a *net.OpError for the operation op, and returns the error it wraps
+func unwrapOpError(err error, op string) error {
+	ExpectWithOffset(1, err).To(BeAssignableToTypeOf(&net.OpError{}))
+	operr := err.(*net.OpError)
+	ExpectWithOffset(1, operr.Op).To(Equal(op))
+	ExpectWithOffset(1, operr.Net).To(Equal("quic"))
+	return operr.Err
+}
+
+var _ = Describe("Errors", func() {
+	It("has a string representation for application errors", func() {
+		Expect((&ApplicationError{Code: 0x42}).Error()).To(Equal("application error 0x42"))
+		Expect((&ApplicationError{Code: 0x42, Reason: "shutting down"}).Error()).To(Equal("application error 0x42: shutting down"))
+	})
+
+	It("has a string representation for unexpected stream errors", func() {
+		Expect((&UnexpectedStreamError{StreamID: 5}).Error()).To(Equal("peer opened unexpected stream 5"))
+	})
+
+	It("has a string representation for ALPN errors", func() {
+		err := &NoApplicationProtocolError{NextProtos: []string{"foo", "bar"}}
+		Expect(err.Error()).To(Equal("no application protocol negotiated, offered: foo, bar"))
+	})
+
+	It("has a string representation for pin mismatches", func() {
+		err := &PinMismatchError{CertificatePin: Pin{1}, PublicKeyPin: Pin{2}}
+		Expect(err.Error()).To(Equal("certificate doesn't match any pin (certificate " + Pin{1}.String() + ", public key " + Pin{2}.String() + ")"))
+	})
+
+	It("unwraps ALPN errors", func() {
+		cerr := &mockCryptoError{ErrorCode: 0x178}
+		var err error = &NoApplicationProtocolError{err: cerr}
+		var target *mockCryptoError
+		Expect(errors.As(err, &target)).To(BeTrue())
+		Expect(target).To(Equal(cerr))
+	})
+
+	It("recognizes TLS alerts", func() {
+		Expect(isTLSAlert(&mockCryptoError{ErrorCode: 0x178}, tlsAlertNoApplicationProtocol)).To(BeTrue())
+		Expect(isTLSAlert(&mockCryptoError{ErrorCode: 0x12a}, tlsAlertNoApplicationProtocol)).To(BeFalse())
+		Expect(isTLSAlert(&mockApplicationError{ErrorCode: 0x178}, tlsAlertNoApplicationProtocol)).To(BeFalse())
+		Expect(isTLSAlert(errors.New("test error"), tlsAlertNoApplicationProtocol)).To(BeFalse())
+	})
+
+	It("checks application error codes", func() {
+		Expect(checkErrorCode(0)).To(Succeed())
+		Expect(checkErrorCode(1<<62 - 1)).To(Succeed())
+		Expect(checkErrorCode(1 << 62)).To(MatchError("application error code 0x4000000000000000 exceeds the maximum of 2^62-1"))
+	})
+
+	It("converts application errors", func() {
+		err := convertError(&mockApplicationError{ErrorCode: 0x42, ErrorMessage: "shutting down"})
+		Expect(err).To(Equal(&ApplicationError{Code: 0x42, Reason: "shutting down"}))
+	})
+
+	It("doesn't convert other errors", func() {
+		testErr := errors.New("test error")
+		Expect(convertError(testErr)).To(MatchError(testErr))
+		Expect(convertError(nil)).To(BeNil())
+	})
+
+	Context("wrapping errors in *net.OpErrors", func() {
+		It("wraps errors", func() {
+			testErr := &ApplicationError{Code: 0x42}
+			local := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1337}
+			remote := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 7331}
+			err := newOpError("read", local, remote, testErr)
+			Expect(err).To(Equal(&net.OpError{Op: "read", Net: "quic", Source: local, Addr: remote, Err: testErr}))
+			var aerr *ApplicationError
+			Expect(errors.As(err, &aerr)).To(BeTrue())
+			Expect(aerr).To(Equal(testErr))
+		})
+
+		It("replaces the Op and Net of *net.OpErrors", func() {
+			testErr := errors.New("test error")
+			err := newOpError("listen", nil, nil, &net.OpError{Op: "listen", Net: "udp", Err: testErr})
+			Expect(unwrapOpError(err, "listen")).To(Equal(testErr))
+		})
+
+		It("preserves timeouts", func() {
+			err := newOpError("write", nil, nil, errDeadline)
+			nerr, ok := err.(net.Error)
+			Expect(ok).To(BeTrue())
+			Expect(nerr.Timeout()).To(BeTrue())
+		})
+
+		It("doesn't wrap io.EOF and nil", func() {
+			Expect(newOpError("read", nil, nil, io.EOF)).To(Equal(io.EOF))
+			Expect(newOpError("read", nil, nil, nil)).To(BeNil())
+		})
+	})
+})
@@ -21,6 +21,7 @@ func main() {
 
 	startServer := flag.Bool("s", false, "server")
 	startClient := flag.Bool("c", false, "client")
+	pin := flag.String("pin", "", "public key pin of the server, as printed by the server")
 	flag.Parse()
 
 	if *startServer {
@@ -31,6 +32,12 @@ func main() {
 				panic(err)
 			}
 
+			cert, err := x509.ParseCertificate(tlsConf.Certificates[0].Certificate[0])
+			if err != nil {
+				panic(err)
+			}
+			fmt.Println("Public key pin:", quicconn.PublicKeyPin(cert))
+
 			ln, err := quicconn.Listen("udp", ":8081", tlsConf)
 			if err != nil {
 				panic(err)
@@ -59,8 +66,17 @@ func main() {
 	if *startClient {
 		// run the client
 		go func() {
-			tlsConf := &tls.Config{InsecureSkipVerify: true}
-			conn, err := quicconn.Dial("quic.clemente.io:8081", tlsConf)
+			d := &quicconn.Dialer{}
+			if *pin != "" {
+				p, err := quicconn.ParsePin(*pin)
+				if err != nil {
+					panic(err)
+				}
+				d.PublicKeyPins = []quicconn.Pin{p}
+			} else {
+				d.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+			}
+			conn, err := d.Dial("udp", "quic.clemente.io:8081")
 			if err != nil {
 				panic(err)
 			}
@@ -0,0 +1,80 @@
+package integrationtests
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	quicconn "github.com/marten-seemann/quic-conn"
+)
+
+// BenchmarkCopy compares io.Copy using the io.ReaderFrom and io.WriterTo implementations of the connection
+// to io.Copy using the generic path with 32 KiB buffers.
+func BenchmarkCopy(b *testing.B) {
+	b.Run("ReadFrom and WriteTo", func(b *testing.B) {
+		benchmarkCopy(b, func(c *quicconn.Conn) io.ReadWriter { return c })
+	})
+	b.Run("generic", func(b *testing.B) {
+		// hide the ReadFrom and WriteTo methods from io.Copy
+		benchmarkCopy(b, func(c *quicconn.Conn) io.ReadWriter { return struct{ io.ReadWriter }{c} })
+	})
+}
+
+func benchmarkCopy(b *testing.B, wrap func(*quicconn.Conn) io.ReadWriter) {
+	const dataLen = 10 << 20 // 10 MB
+	data := make([]byte, dataLen)
+
+	tlsConfig, err := generateTLSConfig()
+	if err != nil {
+		b.Fatal(err)
+	}
+	ln, err := quicconn.Listen("udp", "127.0.0.1:0", tlsConfig)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer ln.Close()
+
+	received := make(chan int64, 1)
+	go func() {
+		serverConn, err := ln.Accept()
+		if err != nil {
+			b.Error(err)
+			close(received)
+			return
+		}
+		defer serverConn.Close()
+		// ioutil.Discard implements io.ReaderFrom, so io.Copy uses it unless the connection implements io.WriterTo
+		n, err := io.Copy(struct{ io.Writer }{ioutil.Discard}, wrap(serverConn.(*quicconn.Conn)))
+		if err != nil {
+			b.Error(err)
+		}
+		received <- n
+	}()
+
+	clientConn, err := quicconn.Dial(ln.Addr().String(), &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{alpn},
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer clientConn.Close()
+
+	b.SetBytes(dataLen)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// hide the WriteTo method of the bytes.Reader, like for a TCP connection
+		if _, err := io.Copy(wrap(clientConn), struct{ io.Reader }{bytes.NewReader(data)}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := clientConn.CloseWrite(); err != nil {
+		b.Fatal(err)
+	}
+	if n := <-received; n != int64(b.N)*dataLen {
+		b.Fatalf("received %d bytes, expected %d", n, int64(b.N)*dataLen)
+	}
+}
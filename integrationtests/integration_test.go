@@ -1,15 +1,21 @@
 package integrationtests
 
 import (
+	"bytes"
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"math/big"
 	mrand "math/rand"
 	"net"
+	"sync"
 	"time"
 
 	quicconn "github.com/marten-seemann/quic-conn"
@@ -19,38 +25,46 @@ import (
 
 const alpn = "quic-conn"
 
+// generateTLSConfig generates a tls.Config with a self-signed certificate
+func generateTLSConfig() (*tls.Config, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		return nil, err
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+
+	tlsCert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{tlsCert},
+		NextProtos:   []string{alpn},
+	}, nil
+}
+
 var _ = Describe("Integration tests", func() {
 	var data []byte
 	var tlsConfig *tls.Config
 	const dataLen = 100 * (1 << 10) // 100 kb
 
-	generateTLSConfig := func() {
-		key, err := rsa.GenerateKey(rand.Reader, 1024)
-		Expect(err).ToNot(HaveOccurred())
-		template := x509.Certificate{
-			SerialNumber: big.NewInt(1),
-			NotBefore:    time.Now(),
-			NotAfter:     time.Now().Add(time.Hour),
-		}
-		certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
-		Expect(err).ToNot(HaveOccurred())
-		keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
-		certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
-
-		tlsCert, err := tls.X509KeyPair(certPEM, keyPEM)
-		Expect(err).ToNot(HaveOccurred())
-		tlsConfig = &tls.Config{
-			Certificates: []tls.Certificate{tlsCert},
-			NextProtos:   []string{alpn},
-		}
-	}
-
 	BeforeEach(func() {
 		r := mrand.New(mrand.NewSource(int64(time.Now().Nanosecond())))
 		data = make([]byte, dataLen)
 		_, err := r.Read(data)
 		Expect(err).ToNot(HaveOccurred())
-		generateTLSConfig()
+		tlsConfig, err = generateTLSConfig()
+		Expect(err).ToNot(HaveOccurred())
 	})
 
 	It("transfers data from the client to the server", func(done Done) {
@@ -192,4 +206,491 @@ var _ = Describe("Integration tests", func() {
 		Eventually(dataChan).Should(Receive(Equal(data)))
 		close(done)
 	}, 10)
+
+	It("half-closes the connection", func(done Done) {
+		serverAddr := make(chan net.Addr)
+		// start the server
+		go func() {
+			defer GinkgoRecover()
+			ln, err := quicconn.Listen("udp", "127.0.0.1:0", tlsConfig)
+			Expect(err).ToNot(HaveOccurred())
+			serverAddr <- ln.Addr()
+			serverConn, err := ln.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			// receive data until the client closes for writing
+			d, err := ioutil.ReadAll(serverConn)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = serverConn.Write(d)
+			Expect(err).ToNot(HaveOccurred())
+		}()
+
+		addr := <-serverAddr
+		tlsConf := &tls.Config{
+			InsecureSkipVerify: true,
+			NextProtos:         []string{alpn},
+		}
+		clientConn, err := quicconn.Dial(addr.String(), tlsConf)
+		Expect(err).ToNot(HaveOccurred())
+		// send data
+		_, err = clientConn.Write(data)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(clientConn.CloseWrite()).To(Succeed())
+		// check received data
+		receivedData := make([]byte, dataLen)
+		_, err = io.ReadFull(clientConn, receivedData)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(receivedData).To(Equal(data))
+		close(done)
+	}, 10)
+
+	for _, l := range []int{-1, 10} {
+		linger := l
+
+		It(fmt.Sprintf("delivers all data when the client closes right after writing, with linger %d", linger), func(done Done) {
+			dataChan := make(chan []byte)
+			serverAddr := make(chan net.Addr)
+			// start the server
+			go func() {
+				defer GinkgoRecover()
+				ln, err := quicconn.Listen("udp", "127.0.0.1:0", tlsConfig)
+				Expect(err).ToNot(HaveOccurred())
+				serverAddr <- ln.Addr()
+				serverConn, err := ln.Accept()
+				Expect(err).ToNot(HaveOccurred())
+				// receive data until the client closes the connection
+				d, err := ioutil.ReadAll(serverConn)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(serverConn.Close()).To(Succeed())
+				dataChan <- d
+			}()
+
+			addr := <-serverAddr
+			tlsConf := &tls.Config{
+				InsecureSkipVerify: true,
+				NextProtos:         []string{alpn},
+			}
+			clientConn, err := quicconn.Dial(addr.String(), tlsConf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(clientConn.SetLinger(linger)).To(Succeed())
+			// send data and close the connection right away
+			_, err = clientConn.Write(data)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(clientConn.Close()).To(Succeed())
+			// check received data
+			Eventually(dataChan, 10).Should(Receive(Equal(data)))
+			close(done)
+		}, 10)
+	}
+
+	for _, l := range []int{-1, 10} {
+		linger := l
+
+		It(fmt.Sprintf("delivers the reply when the server closes right after writing, with linger %d", linger), func(done Done) {
+			ln, err := quicconn.Listen("udp", "127.0.0.1:0", tlsConfig)
+			Expect(err).ToNot(HaveOccurred())
+			defer ln.Close()
+			// start the server
+			serverConnChan := make(chan *quicconn.Conn, 1)
+			serverClosed := make(chan time.Duration, 1)
+			go func() {
+				defer GinkgoRecover()
+				serverConn, err := ln.Accept()
+				Expect(err).ToNot(HaveOccurred())
+				serverConnChan <- serverConn.(*quicconn.Conn)
+				Expect(serverConn.(*quicconn.Conn).SetLinger(linger)).To(Succeed())
+				// read the request until the client closes the connection for writing
+				req, err := ioutil.ReadAll(serverConn)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(req).To(Equal([]byte("request")))
+				// send the reply and close the connection right away
+				_, err = serverConn.Write(data)
+				Expect(err).ToNot(HaveOccurred())
+				start := time.Now()
+				Expect(serverConn.Close()).To(Succeed())
+				serverClosed <- time.Since(start)
+			}()
+
+			clientConn, err := quicconn.Dial(ln.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = clientConn.Write([]byte("request"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(clientConn.CloseWrite()).To(Succeed())
+			reply, err := ioutil.ReadAll(clientConn)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(reply).To(Equal(data))
+			Expect(clientConn.Close()).To(Succeed())
+			// Both sides are done, so the session is closed right away, long before the linger expires.
+			var serverConn *quicconn.Conn
+			Eventually(serverConnChan).Should(Receive(&serverConn))
+			var closeDuration time.Duration
+			Eventually(serverClosed, 2).Should(Receive(&closeDuration))
+			Expect(closeDuration).To(BeNumerically("<", time.Second))
+			Eventually(clientConn.Context().Done()).Should(BeClosed())
+			Eventually(serverConn.Context().Done()).Should(BeClosed())
+			close(done)
+		}, 10)
+	}
+
+	It("unblocks Read with a non-timeout error when the connection is closed", func(done Done) {
+		ln, err := quicconn.Listen("udp", "127.0.0.1:0", tlsConfig)
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+		go func() {
+			defer GinkgoRecover()
+			_, err := ln.Accept()
+			Expect(err).ToNot(HaveOccurred())
+		}()
+
+		clientConn, err := quicconn.Dial(ln.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		Expect(err).ToNot(HaveOccurred())
+		errChan := make(chan error, 1)
+		go func() {
+			_, err := clientConn.Read(make([]byte, 1))
+			errChan <- err
+		}()
+		Consistently(errChan).ShouldNot(Receive())
+		Expect(clientConn.Close()).To(Succeed())
+		var readErr error
+		Eventually(errChan).Should(Receive(&readErr))
+		Expect(readErr.(net.Error).Timeout()).To(BeFalse())
+		Expect(errors.Is(readErr, quicconn.ErrClosed)).To(BeTrue())
+		close(done)
+	}, 10)
+
+	It("closes the connection with an application error", func(done Done) {
+		serverAddr := make(chan net.Addr)
+		// start the server
+		go func() {
+			defer GinkgoRecover()
+			ln, err := quicconn.Listen("udp", "127.0.0.1:0", tlsConfig)
+			Expect(err).ToNot(HaveOccurred())
+			serverAddr <- ln.Addr()
+			serverConn, err := ln.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = serverConn.Read(make([]byte, 1))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(serverConn.(*quicconn.Conn).CloseWithError(0x42, "auth failed")).To(Succeed())
+		}()
+
+		addr := <-serverAddr
+		tlsConf := &tls.Config{
+			InsecureSkipVerify: true,
+			NextProtos:         []string{alpn},
+		}
+		clientConn, err := quicconn.Dial(addr.String(), tlsConf)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = clientConn.Write([]byte("a"))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = clientConn.Read(make([]byte, 1))
+		var opErr *net.OpError
+		Expect(errors.As(err, &opErr)).To(BeTrue())
+		Expect(opErr.Op).To(Equal("read"))
+		Expect(opErr.Net).To(Equal("quic"))
+		Expect(opErr.Addr.String()).To(Equal(addr.String()))
+		var appErr *quicconn.ApplicationError
+		Expect(errors.As(err, &appErr)).To(BeTrue())
+		Expect(appErr.Code).To(BeEquivalentTo(0x42))
+		Expect(appErr.Reason).To(Equal("auth failed"))
+		close(done)
+	}, 10)
+
+	It("reads, writes and closes concurrently", func(done Done) {
+		serverAddr := make(chan net.Addr)
+		// start the server
+		go func() {
+			defer GinkgoRecover()
+			ln, err := quicconn.Listen("udp", "127.0.0.1:0", tlsConfig)
+			Expect(err).ToNot(HaveOccurred())
+			serverAddr <- ln.Addr()
+			serverConn, err := ln.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			// echo all data
+			_, _ = io.Copy(serverConn, serverConn)
+		}()
+
+		addr := <-serverAddr
+		tlsConf := &tls.Config{
+			InsecureSkipVerify: true,
+			NextProtos:         []string{alpn},
+		}
+		clientConn, err := quicconn.Dial(addr.String(), tlsConf)
+		Expect(err).ToNot(HaveOccurred())
+		var wg sync.WaitGroup
+		wg.Add(4)
+		for i := 0; i < 2; i++ {
+			go func() {
+				defer wg.Done()
+				_, _ = io.Copy(ioutil.Discard, clientConn)
+			}()
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					if _, err := clientConn.Write(data[:1000]); err != nil {
+						return
+					}
+				}
+			}()
+		}
+		time.Sleep(50 * time.Millisecond)
+		Expect(clientConn.Close()).To(Succeed())
+		wg.Wait()
+		close(done)
+	}, 10)
+
+	It("delivers records written concurrently", func(done Done) {
+		const (
+			recordSize = 100 << 10 // larger than the flow control window, so Write blocks
+			numRecords = 10
+		)
+		ln, err := quicconn.Listen("udp", "127.0.0.1:0", tlsConfig)
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+		receivedChan := make(chan []byte, 1)
+		go func() {
+			defer GinkgoRecover()
+			serverConn, err := ln.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			b, err := ioutil.ReadAll(serverConn)
+			Expect(err).ToNot(HaveOccurred())
+			receivedChan <- b
+		}()
+
+		clientConn, err := quicconn.Dial(ln.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		Expect(err).ToNot(HaveOccurred())
+		var wg sync.WaitGroup
+		for _, c := range []byte{'a', 'b'} {
+			wg.Add(1)
+			go func(record []byte) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				for i := 0; i < numRecords; i++ {
+					n, err := clientConn.Write(record)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(n).To(Equal(recordSize))
+				}
+			}(bytes.Repeat([]byte{c}, recordSize))
+		}
+		wg.Wait()
+		Expect(clientConn.CloseWrite()).To(Succeed())
+
+		var received []byte
+		Eventually(receivedChan, 5).Should(Receive(&received))
+		Expect(received).To(HaveLen(2 * numRecords * recordSize))
+		counts := make(map[byte]int)
+		for len(received) > 0 {
+			record := received[:recordSize]
+			Expect(bytes.Count(record, record[:1])).To(Equal(recordSize))
+			counts[record[0]]++
+			received = received[recordSize:]
+		}
+		Expect(counts).To(Equal(map[byte]int{'a': numRecords, 'b': numRecords}))
+		Expect(clientConn.Close()).To(Succeed())
+		close(done)
+	}, 10)
+
+	It("exposes the TLS connection state", func(done Done) {
+		serverConnChan := make(chan *quicconn.Conn)
+		serverAddr := make(chan net.Addr)
+		// start the server
+		go func() {
+			defer GinkgoRecover()
+			ln, err := quicconn.Listen("udp", "127.0.0.1:0", tlsConfig)
+			Expect(err).ToNot(HaveOccurred())
+			serverAddr <- ln.Addr()
+			serverConn, err := ln.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(serverConn).To(BeAssignableToTypeOf(&quicconn.Conn{}))
+			serverConnChan <- serverConn.(*quicconn.Conn)
+		}()
+
+		addr := <-serverAddr
+		tlsConf := &tls.Config{
+			InsecureSkipVerify: true,
+			NextProtos:         []string{alpn},
+		}
+		clientConn, err := quicconn.Dial(addr.String(), tlsConf)
+		Expect(err).ToNot(HaveOccurred())
+		state := clientConn.ConnectionState()
+		Expect(state.NegotiatedProtocol).To(Equal(alpn))
+		Expect(state.PeerCertificates).To(HaveLen(1))
+		Expect(state.PeerCertificates[0].Raw).To(Equal(tlsConfig.Certificates[0].Certificate[0]))
+		Expect(clientConn.Session().RemoteAddr().String()).To(Equal(addr.String()))
+		serverConn := <-serverConnChan
+		Expect(serverConn.ConnectionState().NegotiatedProtocol).To(Equal(alpn))
+		Expect(clientConn.CloseWithError(0, "")).To(Succeed())
+		Eventually(serverConn.Context().Done()).Should(BeClosed())
+		close(done)
+	}, 10)
+
+	It("resumes TLS sessions", func(done Done) {
+		// start the server
+		ln, err := quicconn.Listen("udp", "127.0.0.1:0", tlsConfig)
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+		go func() {
+			defer GinkgoRecover()
+			for {
+				serverConn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				// the session ticket is sent after the handshake
+				_, err = serverConn.Write([]byte("a"))
+				Expect(err).ToNot(HaveOccurred())
+			}
+		}()
+
+		d := &quicconn.Dialer{
+			TLSConfig: &tls.Config{
+				InsecureSkipVerify: true,
+				NextProtos:         []string{alpn},
+			},
+		}
+		for i := 0; i < 2; i++ {
+			c, err := d.Dial("udp", ln.Addr().String())
+			Expect(err).ToNot(HaveOccurred())
+			_, err = io.ReadFull(c, make([]byte, 1))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.(*quicconn.Conn).DidResume()).To(Equal(i > 0))
+			Expect(c.(*quicconn.Conn).CloseWithError(0, "")).To(Succeed())
+		}
+		close(done)
+	}, 10)
+
+	It("negotiates the default application protocol", func(done Done) {
+		tlsConfig.NextProtos = nil
+		ln, err := quicconn.Listen("udp", "127.0.0.1:0", tlsConfig)
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+		serverConnChan := make(chan net.Conn)
+		go func() {
+			defer GinkgoRecover()
+			serverConn, err := ln.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			serverConnChan <- serverConn
+		}()
+
+		clientConn, err := quicconn.Dial(ln.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(clientConn.ConnectionState().NegotiatedProtocol).To(Equal(quicconn.DefaultNextProto))
+		var serverConn net.Conn
+		Eventually(serverConnChan).Should(Receive(&serverConn))
+		Expect(serverConn.(*quicconn.Conn).ConnectionState().NegotiatedProtocol).To(Equal(quicconn.DefaultNextProto))
+		Expect(clientConn.CloseWithError(0, "")).To(Succeed())
+		close(done)
+	}, 10)
+
+	It("returns an error if ALPN fails", func(done Done) {
+		ln, err := quicconn.Listen("udp", "127.0.0.1:0", tlsConfig)
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+
+		_, err = quicconn.Dial(ln.Addr().String(), &tls.Config{
+			InsecureSkipVerify: true,
+			NextProtos:         []string{"foo"},
+		})
+		var alpnErr *quicconn.NoApplicationProtocolError
+		Expect(errors.As(err, &alpnErr)).To(BeTrue())
+		Expect(alpnErr.NextProtos).To(Equal([]string{"foo"}))
+		close(done)
+	}, 10)
+
+	It("returns ErrClosed when the listener is closed", func(done Done) {
+		ln, err := quicconn.Listen("udp", "127.0.0.1:0", tlsConfig)
+		Expect(err).ToNot(HaveOccurred())
+		errChan := make(chan error, 1)
+		go func() {
+			_, err := ln.Accept()
+			errChan <- err
+		}()
+		Consistently(errChan).ShouldNot(Receive())
+		Expect(ln.Close()).To(Succeed())
+		var acceptErr error
+		Eventually(errChan).Should(Receive(&acceptErr))
+		Expect(errors.Is(acceptErr, quicconn.ErrClosed)).To(BeTrue())
+		close(done)
+	}, 10)
+
+	It("shuts down gracefully", func(done Done) {
+		ln, err := quicconn.Listen("udp", "127.0.0.1:0", tlsConfig)
+		Expect(err).ToNot(HaveOccurred())
+		serverConnChan := make(chan net.Conn, 1)
+		go func() {
+			defer GinkgoRecover()
+			serverConn, err := ln.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			serverConnChan <- serverConn
+		}()
+		clientConn, err := quicconn.Dial(ln.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		Expect(err).ToNot(HaveOccurred())
+		var serverConn net.Conn
+		Eventually(serverConnChan).Should(Receive(&serverConn))
+
+		shutdownErr := make(chan error, 1)
+		go func() {
+			shutdownErr <- ln.Shutdown(context.Background())
+		}()
+		Consistently(shutdownErr).ShouldNot(Receive())
+		// the connection can still be used
+		_, err = clientConn.Write([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		b := make([]byte, 6)
+		_, err = io.ReadFull(serverConn, b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b).To(Equal([]byte("foobar")))
+		Expect(serverConn.(*quicconn.Conn).CloseWithError(0, "")).To(Succeed())
+		Eventually(shutdownErr).Should(Receive(BeNil()))
+		close(done)
+	}, 10)
+
+	It("closes connections when the Shutdown context expires", func(done Done) {
+		ln, err := quicconn.Listen("udp", "127.0.0.1:0", tlsConfig)
+		Expect(err).ToNot(HaveOccurred())
+		accepted := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			_, err := ln.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			close(accepted)
+		}()
+		clientConn, err := quicconn.Dial(ln.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(accepted).Should(BeClosed())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		Expect(ln.ShutdownWithError(ctx, 0x42, "shutting down")).To(MatchError(context.DeadlineExceeded))
+		_, err = clientConn.Read(make([]byte, 1))
+		var appErr *quicconn.ApplicationError
+		Expect(errors.As(err, &appErr)).To(BeTrue())
+		Expect(appErr.Code).To(BeEquivalentTo(0x42))
+		Expect(appErr.Reason).To(Equal("shutting down"))
+		close(done)
+	}, 10)
+
+	It("stops accepting when the deadline expires", func(done Done) {
+		ln, err := quicconn.Listen("udp", "127.0.0.1:0", tlsConfig)
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+
+		Expect(ln.SetDeadline(time.Now().Add(100 * time.Millisecond))).To(Succeed())
+		_, err = ln.Accept()
+		Expect(err).To(HaveOccurred())
+		Expect(err.(net.Error).Timeout()).To(BeTrue())
+
+		// the listener accepts connections after the deadline is reset
+		Expect(ln.SetDeadline(time.Time{})).To(Succeed())
+		go func() {
+			defer GinkgoRecover()
+			clientConn, err := quicconn.Dial(ln.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(clientConn.Close()).To(Succeed())
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		serverConn, err := ln.AcceptContext(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(serverConn.CloseWithError(0, "")).To(Succeed())
+		close(done)
+	}, 10)
 })
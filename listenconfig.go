@@ -0,0 +1,111 @@
+package quicconn
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"syscall"
+
+	quic "github.com/lucas-clemente/quic-go"
+)
+
+// A ListenConfig contains options for listening for QUIC connections.
+// It mirrors net.ListenConfig.
+type ListenConfig struct {
+	// TLSConfig is the TLS configuration used for the handshake.
+	// It must contain at least one certificate.
+	// If NextProtos is empty, DefaultNextProto is used.
+	// The config is not modified.
+	TLSConfig *tls.Config
+
+	// QUICConfig is the QUIC configuration, for example to set idle timeouts,
+	// flow control windows or the QUIC versions.
+	// Since every connection carries a single stream opened by the client,
+	// the defaults of the stream limits differ from quic-go:
+	// If MaxIncomingStreams is zero, the client is allowed to open a single bidirectional stream,
+	// and if MaxIncomingUniStreams is zero, it is not allowed to open any unidirectional streams.
+	// The config is not modified.
+	QUICConfig *quic.Config
+
+	// KeepAlive enables sending keep-alive packets,
+	// so that connections are not closed when they are idle.
+	// If set, it overrides the KeepAlive field of QUICConfig.
+	KeepAlive bool
+
+	// If Control is not nil, it is called after creating the UDP socket,
+	// but before binding it, see net.ListenConfig.
+	Control func(network, address string, c syscall.RawConn) error
+}
+
+// Listen creates a QUIC listener on the given local address.
+// The context is only used for resolving the address.
+// The UDP socket is closed when the listener is closed.
+// The listener is a *Listener.
+// Errors are returned as a *net.OpError.
+func (lc *ListenConfig) Listen(ctx context.Context, network, address string) (net.Listener, error) {
+	ln, err := lc.listen(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	return ln, nil
+}
+
+// ListenPacket creates a QUIC listener using an existing net.PacketConn,
+// for example a socket passed in by systemd socket activation.
+// Unlike net.ListenConfig.ListenPacket, it doesn't create a socket.
+// The PacketConn is owned by the caller, and is not closed when the listener is closed.
+// It must not be used for anything else, since the listener reads all packets from it.
+// The listener is a *Listener.
+// Errors are returned as a *net.OpError.
+func (lc *ListenConfig) ListenPacket(pconn net.PacketConn) (net.Listener, error) {
+	ln, err := lc.listenPacket(pconn)
+	if err != nil {
+		return nil, err
+	}
+	return ln, nil
+}
+
+func (lc *ListenConfig) listen(ctx context.Context, network, address string) (*Listener, error) {
+	nlc := &net.ListenConfig{Control: lc.Control}
+	conn, err := nlc.ListenPacket(ctx, network, address)
+	if err != nil {
+		// the net package sets the address if binding the socket failed
+		var addr net.Addr
+		if operr, ok := err.(*net.OpError); ok {
+			addr = operr.Addr
+		}
+		return nil, newOpError("listen", nil, addr, err)
+	}
+	ln, err := lc.listenPacket(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	ln.conn = conn
+	return ln, nil
+}
+
+func (lc *ListenConfig) listenPacket(pconn net.PacketConn) (*Listener, error) {
+	ln, err := quicListen(pconn, withDefaultNextProto(lc.TLSConfig), lc.quicConfig())
+	if err != nil {
+		return nil, newOpError("listen", nil, pconn.LocalAddr(), err)
+	}
+	return newListener(ln), nil
+}
+
+func (lc *ListenConfig) quicConfig() *quic.Config {
+	conf := &quic.Config{}
+	if lc.QUICConfig != nil {
+		*conf = *lc.QUICConfig
+	}
+	if conf.MaxIncomingStreams == 0 {
+		conf.MaxIncomingStreams = 1
+	}
+	if conf.MaxIncomingUniStreams == 0 {
+		conf.MaxIncomingUniStreams = -1
+	}
+	if lc.KeepAlive {
+		conf.KeepAlive = true
+	}
+	return conf
+}
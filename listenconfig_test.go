@@ -0,0 +1,87 @@
+package quicconn
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"syscall"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ListenConfig", func() {
+	var quicConf *quic.Config
+
+	BeforeEach(func() {
+		quicConf = nil
+		quicListen = func(_ net.PacketConn, _ *tls.Config, conf *quic.Config) (quic.Listener, error) {
+			quicConf = conf
+			return nil, nil
+		}
+	})
+
+	AfterEach(func() {
+		quicListen = quic.Listen
+	})
+
+	It("uses stream limits for a single stream", func() {
+		lc := &ListenConfig{}
+		_, err := lc.Listen(context.Background(), "udp", "localhost:0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(quicConf.MaxIncomingStreams).To(Equal(1))
+		Expect(quicConf.MaxIncomingUniStreams).To(Equal(-1))
+	})
+
+	It("uses the QUIC config, without modifying it", func() {
+		conf := &quic.Config{
+			IdleTimeout:        time.Minute,
+			MaxIncomingStreams: 10,
+			Versions:           []quic.VersionNumber{0x42},
+		}
+		lc := &ListenConfig{QUICConfig: conf, KeepAlive: true}
+		_, err := lc.Listen(context.Background(), "udp", "localhost:0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(quicConf.IdleTimeout).To(Equal(time.Minute))
+		Expect(quicConf.Versions).To(Equal(conf.Versions))
+		Expect(quicConf.MaxIncomingStreams).To(Equal(10))
+		Expect(quicConf.MaxIncomingUniStreams).To(Equal(-1))
+		Expect(quicConf.KeepAlive).To(BeTrue())
+		Expect(conf.MaxIncomingUniStreams).To(BeZero())
+		Expect(conf.KeepAlive).To(BeFalse())
+	})
+
+	It("calls the Control function", func() {
+		var address string
+		lc := &ListenConfig{
+			Control: func(_, a string, _ syscall.RawConn) error {
+				address = a
+				return nil
+			},
+		}
+		_, err := lc.Listen(context.Background(), "udp", "127.0.0.1:12347")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(address).To(Equal("127.0.0.1:12347"))
+	})
+
+	It("returns errors from the Control function", func() {
+		testErr := errors.New("control error")
+		lc := &ListenConfig{
+			Control: func(string, string, syscall.RawConn) error { return testErr },
+		}
+		_, err := lc.Listen(context.Background(), "udp", "127.0.0.1:12348")
+		Expect(unwrapOpError(err, "listen")).To(MatchError(testErr))
+		Expect(err.(*net.OpError).Addr.String()).To(Equal("127.0.0.1:12348"))
+	})
+
+	It("aborts resolving the address when the context is canceled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := (&ListenConfig{}).Listen(ctx, "udp", "quic.invalid:443")
+		Expect(unwrapOpError(err, "listen")).To(HaveOccurred())
+		Expect(err.(*net.OpError).Addr).To(BeNil())
+	})
+})
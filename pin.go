@@ -0,0 +1,147 @@
+package quicconn
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+const pinPrefix = "sha256/"
+
+// A Pin is the SHA-256 hash of a certificate, or of the public key of a certificate,
+// used to pin the certificate of a server, see Dialer.CertificatePins and Dialer.PublicKeyPins.
+type Pin [sha256.Size]byte
+
+// String returns the base64 encoded hash, prefixed by "sha256/", as used by HPKP (RFC 7469).
+func (p Pin) String() string {
+	return pinPrefix + base64.StdEncoding.EncodeToString(p[:])
+}
+
+// ParsePin parses a pin in the format returned by Pin.String.
+func ParsePin(s string) (Pin, error) {
+	var p Pin
+	if !strings.HasPrefix(s, pinPrefix) {
+		return p, fmt.Errorf("invalid pin %q: missing %q prefix", s, pinPrefix)
+	}
+	b, err := base64.StdEncoding.DecodeString(s[len(pinPrefix):])
+	if err != nil {
+		return p, fmt.Errorf("invalid pin %q: %s", s, err)
+	}
+	if len(b) != len(p) {
+		return p, fmt.Errorf("invalid pin %q: hash has length %d", s, len(b))
+	}
+	copy(p[:], b)
+	return p, nil
+}
+
+// CertificatePin returns the pin of a certificate.
+// It changes whenever the certificate is renewed.
+func CertificatePin(cert *x509.Certificate) Pin {
+	return sha256.Sum256(cert.Raw)
+}
+
+// PublicKeyPin returns the pin of the public key (the SubjectPublicKeyInfo) of a certificate.
+// It stays the same when the certificate is renewed using the same key.
+func PublicKeyPin(cert *x509.Certificate) Pin {
+	return sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+}
+
+// CertificatePinsFromPEM returns the pins of all certificates in the PEM encoded data.
+func CertificatePinsFromPEM(data []byte) ([]Pin, error) {
+	var pins []Pin
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		pins = append(pins, CertificatePin(cert))
+	}
+	if len(pins) == 0 {
+		return nil, errors.New("no certificates found in PEM data")
+	}
+	return pins, nil
+}
+
+// PublicKeyPinsFromPEM returns the public key pins of all certificates and public keys in the PEM encoded data.
+func PublicKeyPinsFromPEM(data []byte) ([]Pin, error) {
+	var pins []Pin
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			pins = append(pins, PublicKeyPin(cert))
+		case "PUBLIC KEY":
+			if _, err := x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+				return nil, err
+			}
+			pins = append(pins, sha256.Sum256(block.Bytes))
+		}
+	}
+	if len(pins) == 0 {
+		return nil, errors.New("no certificates or public keys found in PEM data")
+	}
+	return pins, nil
+}
+
+// LoadCertificatePins reads the PEM encoded certificates in a file and returns their pins.
+func LoadCertificatePins(file string) ([]Pin, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return CertificatePinsFromPEM(data)
+}
+
+// LoadPublicKeyPins reads the PEM encoded certificates and public keys in a file and returns their public key pins.
+func LoadPublicKeyPins(file string) ([]Pin, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return PublicKeyPinsFromPEM(data)
+}
+
+// verifyPins checks that the leaf certificate matches one of the pins.
+func verifyPins(certPins, keyPins []Pin, rawCerts [][]byte) error {
+	if len(rawCerts) == 0 {
+		return errors.New("server didn't send a certificate")
+	}
+	cert, err := x509.ParseCertificate(rawCerts[0])
+	if err != nil {
+		return err
+	}
+	certPin := CertificatePin(cert)
+	for _, p := range certPins {
+		if p == certPin {
+			return nil
+		}
+	}
+	keyPin := PublicKeyPin(cert)
+	for _, p := range keyPins {
+		if p == keyPin {
+			return nil
+		}
+	}
+	return &PinMismatchError{CertificatePin: certPin, PublicKeyPin: keyPin}
+}
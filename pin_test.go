@@ -0,0 +1,106 @@
+package quicconn
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Pins", func() {
+	var cert *x509.Certificate
+
+	BeforeEach(func() {
+		var err error
+		cert, err = x509.ParseCertificate(generateTLSConfig().Certificates[0].Certificate[0])
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	certPEM := func(cert *x509.Certificate) []byte {
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+
+	It("computes pins", func() {
+		Expect(CertificatePin(cert)).To(Equal(Pin(sha256.Sum256(cert.Raw))))
+		Expect(PublicKeyPin(cert)).To(Equal(Pin(sha256.Sum256(cert.RawSubjectPublicKeyInfo))))
+	})
+
+	It("has a string representation", func() {
+		var p Pin
+		p[0] = 0xff
+		Expect(p.String()).To(Equal("sha256/" + "/wAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="))
+	})
+
+	It("parses pins", func() {
+		p := CertificatePin(cert)
+		parsed, err := ParsePin(p.String())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(parsed).To(Equal(p))
+	})
+
+	It("rejects invalid pins", func() {
+		_, err := ParsePin("md5/AAAA")
+		Expect(err).To(MatchError(ContainSubstring(`missing "sha256/" prefix`)))
+		_, err = ParsePin("sha256/foo!")
+		Expect(err).To(MatchError(ContainSubstring("illegal base64 data")))
+		_, err = ParsePin("sha256/AAAA")
+		Expect(err).To(MatchError(ContainSubstring("hash has length 3")))
+	})
+
+	It("computes pins from PEM data", func() {
+		cert2, err := x509.ParseCertificate(generateTLSConfig().Certificates[0].Certificate[0])
+		Expect(err).ToNot(HaveOccurred())
+		data := append(certPEM(cert), certPEM(cert2)...)
+		pins, err := CertificatePinsFromPEM(data)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pins).To(Equal([]Pin{CertificatePin(cert), CertificatePin(cert2)}))
+		pins, err = PublicKeyPinsFromPEM(data)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pins).To(Equal([]Pin{PublicKeyPin(cert), PublicKeyPin(cert2)}))
+	})
+
+	It("computes public key pins from PEM encoded public keys", func() {
+		data := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: cert.RawSubjectPublicKeyInfo})
+		pins, err := PublicKeyPinsFromPEM(data)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pins).To(Equal([]Pin{PublicKeyPin(cert)}))
+	})
+
+	It("rejects PEM data without certificates", func() {
+		data := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: cert.RawSubjectPublicKeyInfo})
+		_, err := CertificatePinsFromPEM(data)
+		Expect(err).To(MatchError("no certificates found in PEM data"))
+		_, err = PublicKeyPinsFromPEM([]byte("foobar"))
+		Expect(err).To(MatchError("no certificates or public keys found in PEM data"))
+	})
+
+	It("loads pins from files", func() {
+		dir, err := ioutil.TempDir("", "quic-conn")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+		file := filepath.Join(dir, "cert.pem")
+		Expect(ioutil.WriteFile(file, certPEM(cert), 0600)).To(Succeed())
+		pins, err := LoadCertificatePins(file)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pins).To(Equal([]Pin{CertificatePin(cert)}))
+		pins, err = LoadPublicKeyPins(file)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pins).To(Equal([]Pin{PublicKeyPin(cert)}))
+		_, err = LoadCertificatePins(filepath.Join(dir, "foo.pem"))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("verifies pins", func() {
+		rawCerts := [][]byte{cert.Raw}
+		Expect(verifyPins([]Pin{{}, CertificatePin(cert)}, nil, rawCerts)).To(Succeed())
+		Expect(verifyPins(nil, []Pin{PublicKeyPin(cert)}, rawCerts)).To(Succeed())
+		err := verifyPins([]Pin{PublicKeyPin(cert)}, []Pin{CertificatePin(cert)}, rawCerts)
+		Expect(err).To(Equal(&PinMismatchError{CertificatePin: CertificatePin(cert), PublicKeyPin: PublicKeyPin(cert)}))
+		Expect(verifyPins([]Pin{{}}, nil, nil)).To(MatchError("server didn't send a certificate"))
+	})
+})
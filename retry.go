@@ -0,0 +1,142 @@
+package quicconn
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultInitialBackoff = 100 * time.Millisecond
+	defaultMaxBackoff     = 10 * time.Second
+	defaultMultiplier     = 2
+)
+
+// A RetryPolicy configures how failed dials are retried.
+// Between attempts, the Dialer waits for an exponentially growing backoff.
+// The Timeout and Deadline of the Dialer and the deadline of the context apply to all attempts together.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first one.
+	// A value smaller than 2 disables retrying.
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the first retry.
+	// If zero, a delay of 100ms is used.
+	InitialBackoff time.Duration
+
+	// MaxBackoff is the maximum delay between two attempts.
+	// If zero, a maximum of 10s is used.
+	MaxBackoff time.Duration
+
+	// Multiplier is the factor by which the backoff grows after every attempt.
+	// If smaller than 1, a factor of 2 is used.
+	Multiplier float64
+
+	// Jitter randomizes the backoff, such that attempts of different clients are spread out.
+	// The backoff is chosen uniformly from the interval [(1-Jitter)*backoff, backoff].
+	// It must be between 0 (no jitter) and 1.
+	Jitter float64
+
+	// AttemptTimeout is the maximum amount of time a single attempt may take.
+	// If zero, an attempt may take as long as allowed by the Timeout and Deadline of the Dialer.
+	AttemptTimeout time.Duration
+
+	// Retryable reports whether a dial error should be retried.
+	// If nil, DefaultRetryable is used.
+	Retryable func(err error) bool
+}
+
+// DefaultRetryable reports whether a dial error is known to be safe to retry.
+// These are timeouts, including handshake timeouts and expiry of the AttemptTimeout,
+// temporary DNS errors, and ICMP errors reporting that the host or network is unreachable,
+// or that the connection was refused.
+// Errors caused by the peer rejecting the connection, like TLS errors, are not retried.
+func DefaultRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var nerr net.Error
+	if errors.As(err, &nerr) && nerr.Timeout() {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTemporary
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EHOSTUNREACH) ||
+		errors.Is(err, syscall.ENETUNREACH)
+}
+
+// do calls dial until it succeeds, the maximum number of attempts is reached,
+// a non-retryable error occurs, or the context is done.
+// If dialing fails, the error of the last attempt is returned.
+func (p *RetryPolicy) do(ctx context.Context, dial func(context.Context) (*Conn, error)) (*Conn, error) {
+	backoff := p.initialBackoff()
+	for attempt := 1; ; attempt++ {
+		c, err := p.attempt(ctx, dial)
+		if err == nil {
+			return c, nil
+		}
+		if attempt >= p.MaxAttempts || ctx.Err() != nil || !p.retryable(err) {
+			return nil, err
+		}
+		timer := time.NewTimer(p.jitter(backoff))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+		backoff = p.nextBackoff(backoff)
+	}
+}
+
+func (p *RetryPolicy) attempt(ctx context.Context, dial func(context.Context) (*Conn, error)) (*Conn, error) {
+	if p.AttemptTimeout == 0 {
+		return dial(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.AttemptTimeout)
+	defer cancel()
+	return dial(ctx)
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if p.Retryable == nil {
+		return DefaultRetryable(err)
+	}
+	return p.Retryable(err)
+}
+
+func (p *RetryPolicy) initialBackoff() time.Duration {
+	if p.InitialBackoff == 0 {
+		return defaultInitialBackoff
+	}
+	return p.InitialBackoff
+}
+
+func (p *RetryPolicy) nextBackoff(backoff time.Duration) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = defaultMultiplier
+	}
+	maxBackoff := p.MaxBackoff
+	if maxBackoff == 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+	next := time.Duration(float64(backoff) * multiplier)
+	if next > maxBackoff {
+		return maxBackoff
+	}
+	return next
+}
+
+func (p *RetryPolicy) jitter(backoff time.Duration) time.Duration {
+	if p.Jitter <= 0 {
+		return backoff
+	}
+	return backoff - time.Duration(p.Jitter*rand.Float64()*float64(backoff))
+}
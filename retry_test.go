@@ -0,0 +1,280 @@
+package quicconn
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// droppingProxy forwards UDP packets to a server.
+// All packets sent by the first numDropped clients are dropped,
+// such that their handshakes time out.
+// Clients are identified by the source connection ID of their long header packets,
+// since a retried handshake might reuse the UDP port of a previous attempt.
+type droppingProxy struct {
+	conn       *net.UDPConn
+	serverAddr *net.UDPAddr
+	numDropped int
+
+	mutex     sync.Mutex
+	clients   map[string]bool         // true for clients whose packets are dropped
+	upstreams map[string]*net.UDPConn // by remote address
+}
+
+func newDroppingProxy(serverAddr net.Addr, numDropped int) *droppingProxy {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	p := &droppingProxy{
+		conn:       conn,
+		serverAddr: serverAddr.(*net.UDPAddr),
+		numDropped: numDropped,
+		clients:    make(map[string]bool),
+		upstreams:  make(map[string]*net.UDPConn),
+	}
+	go p.run()
+	return p
+}
+
+func (p *droppingProxy) run() {
+	b := make([]byte, 2000)
+	for {
+		n, addr, err := p.conn.ReadFromUDP(b)
+		if err != nil {
+			return
+		}
+		if p.drop(b[:n]) {
+			continue
+		}
+		upstream, err := p.upstream(addr)
+		if err != nil {
+			return
+		}
+		upstream.Write(b[:n])
+	}
+}
+
+// drop decides if a packet is dropped, based on the client that sent it
+func (p *droppingProxy) drop(data []byte) bool {
+	// only long header packets carry the source connection ID
+	if len(data) < 6 || data[0]&0x80 == 0 {
+		return false
+	}
+	scidLenPos := 6 + int(data[5])
+	if len(data) <= scidLenPos || len(data) < scidLenPos+1+int(data[scidLenPos]) {
+		return false
+	}
+	scid := string(data[scidLenPos+1 : scidLenPos+1+int(data[scidLenPos])])
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	dropped, ok := p.clients[scid]
+	if !ok {
+		dropped = len(p.clients) < p.numDropped
+		p.clients[scid] = dropped
+	}
+	return dropped
+}
+
+func (p *droppingProxy) upstream(addr *net.UDPAddr) (*net.UDPConn, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if upstream, ok := p.upstreams[addr.String()]; ok {
+		return upstream, nil
+	}
+	upstream, err := net.DialUDP("udp", nil, p.serverAddr)
+	if err != nil {
+		return nil, err
+	}
+	p.upstreams[addr.String()] = upstream
+	go func() {
+		b := make([]byte, 2000)
+		for {
+			n, err := upstream.Read(b)
+			if err != nil {
+				return
+			}
+			p.conn.WriteToUDP(b[:n], addr)
+		}
+	}()
+	return upstream, nil
+}
+
+// NumClients returns the number of clients that sent packets to the proxy
+func (p *droppingProxy) NumClients() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return len(p.clients)
+}
+
+func (p *droppingProxy) LocalAddr() net.Addr {
+	return p.conn.LocalAddr()
+}
+
+func (p *droppingProxy) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, upstream := range p.upstreams {
+		upstream.Close()
+	}
+	return p.conn.Close()
+}
+
+var _ = Describe("Retries", func() {
+	var (
+		ln            net.Listener
+		clientTLSConf *tls.Config
+	)
+
+	BeforeEach(func() {
+		var err error
+		ln, err = Listen("udp", "127.0.0.1:0", generateTLSConfig())
+		Expect(err).ToNot(HaveOccurred())
+		clientTLSConf = &tls.Config{InsecureSkipVerify: true}
+	})
+
+	AfterEach(func() {
+		Expect(ln.Close()).To(Succeed())
+	})
+
+	Context("dialing", func() {
+		var proxy *droppingProxy
+
+		AfterEach(func() {
+			Expect(proxy.Close()).To(Succeed())
+		})
+
+		It("retries handshakes that time out", func() {
+			proxy = newDroppingProxy(ln.Addr(), 2)
+			d := &Dialer{
+				TLSConfig: clientTLSConf,
+				Retry: &RetryPolicy{
+					MaxAttempts:    3,
+					InitialBackoff: 10 * time.Millisecond,
+					// leave enough time for the handshake to complete on a loaded machine
+					AttemptTimeout: time.Second,
+				},
+			}
+			c, err := d.Dial("udp", proxy.LocalAddr().String())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(proxy.NumClients()).To(Equal(3))
+			Expect(c.(*Conn).CloseWithError(0, "")).To(Succeed())
+		})
+
+		It("returns the error of the last attempt", func() {
+			proxy = newDroppingProxy(ln.Addr(), 3)
+			d := &Dialer{
+				TLSConfig: clientTLSConf,
+				Retry: &RetryPolicy{
+					MaxAttempts:    3,
+					InitialBackoff: 10 * time.Millisecond,
+					AttemptTimeout: 100 * time.Millisecond,
+				},
+			}
+			_, err := d.Dial("udp", proxy.LocalAddr().String())
+			Expect(unwrapOpError(err, "dial")).To(MatchError(context.DeadlineExceeded))
+			Expect(proxy.NumClients()).To(Equal(3))
+		})
+
+		It("stops retrying when the Dialer times out", func() {
+			proxy = newDroppingProxy(ln.Addr(), 100)
+			d := &Dialer{
+				TLSConfig: clientTLSConf,
+				Timeout:   250 * time.Millisecond,
+				Retry: &RetryPolicy{
+					MaxAttempts:    100,
+					InitialBackoff: 10 * time.Millisecond,
+					AttemptTimeout: 100 * time.Millisecond,
+				},
+			}
+			start := time.Now()
+			_, err := d.Dial("udp", proxy.LocalAddr().String())
+			Expect(err).To(HaveOccurred())
+			Expect(time.Since(start)).To(BeNumerically("<", 500*time.Millisecond))
+			Expect(proxy.NumClients()).To(BeNumerically("<=", 3))
+		})
+
+		It("doesn't retry errors that are not retryable", func() {
+			proxy = newDroppingProxy(ln.Addr(), 0)
+			clientTLSConf.NextProtos = []string{"foo"}
+			d := &Dialer{
+				TLSConfig: clientTLSConf,
+				Retry:     &RetryPolicy{MaxAttempts: 3, InitialBackoff: 10 * time.Millisecond},
+			}
+			_, err := d.Dial("udp", proxy.LocalAddr().String())
+			Expect(unwrapOpError(err, "dial")).To(BeAssignableToTypeOf(&NoApplicationProtocolError{}))
+			Expect(proxy.NumClients()).To(Equal(1))
+		})
+	})
+
+	It("retries dials over an existing PacketConn", func() {
+		pconn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		Expect(err).ToNot(HaveOccurred())
+		defer pconn.Close()
+		// nobody is listening on this address
+		closedConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		Expect(err).ToNot(HaveOccurred())
+		raddr := closedConn.LocalAddr()
+		Expect(closedConn.Close()).To(Succeed())
+		var retries int
+		d := &Dialer{
+			TLSConfig: clientTLSConf,
+			Retry: &RetryPolicy{
+				MaxAttempts:    3,
+				InitialBackoff: 10 * time.Millisecond,
+				AttemptTimeout: 100 * time.Millisecond,
+				Retryable: func(err error) bool {
+					retries++
+					return DefaultRetryable(err)
+				},
+			},
+		}
+		_, err = d.DialPacketConn(context.Background(), pconn, raddr, "localhost")
+		Expect(unwrapOpError(err, "dial")).To(MatchError(context.DeadlineExceeded))
+		Expect(retries).To(Equal(2))
+	})
+
+	It("calculates the backoff", func() {
+		p := &RetryPolicy{}
+		Expect(p.initialBackoff()).To(Equal(100 * time.Millisecond))
+		Expect(p.nextBackoff(100 * time.Millisecond)).To(Equal(200 * time.Millisecond))
+		Expect(p.nextBackoff(8 * time.Second)).To(Equal(10 * time.Second))
+		p = &RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second, Multiplier: 3}
+		Expect(p.initialBackoff()).To(Equal(time.Second))
+		Expect(p.nextBackoff(time.Second)).To(Equal(3 * time.Second))
+		Expect(p.nextBackoff(3 * time.Second)).To(Equal(5 * time.Second))
+	})
+
+	It("adds jitter", func() {
+		Expect((&RetryPolicy{}).jitter(time.Second)).To(Equal(time.Second))
+		p := &RetryPolicy{Jitter: 0.5}
+		var sawJitter bool
+		for i := 0; i < 100; i++ {
+			backoff := p.jitter(time.Second)
+			Expect(backoff).To(And(
+				BeNumerically(">=", 500*time.Millisecond),
+				BeNumerically("<=", time.Second),
+			))
+			if backoff != time.Second {
+				sawJitter = true
+			}
+		}
+		Expect(sawJitter).To(BeTrue())
+	})
+
+	It("decides which errors are retryable", func() {
+		Expect(DefaultRetryable(newOpError("dial", nil, nil, context.DeadlineExceeded))).To(BeTrue())
+		Expect(DefaultRetryable(newOpError("dial", nil, nil, context.Canceled))).To(BeFalse())
+		Expect(DefaultRetryable(&net.DNSError{IsTemporary: true})).To(BeTrue())
+		Expect(DefaultRetryable(&net.DNSError{IsNotFound: true})).To(BeFalse())
+		Expect(DefaultRetryable(&net.OpError{Op: "read", Err: os.NewSyscallError("recvfrom", syscall.ECONNREFUSED)})).To(BeTrue())
+		Expect(DefaultRetryable(newOpError("dial", nil, nil, &NoApplicationProtocolError{}))).To(BeFalse())
+		Expect(DefaultRetryable(errors.New("test error"))).To(BeFalse())
+	})
+})
@@ -3,36 +3,256 @@ package quicconn
 import (
 	"context"
 	"net"
+	"sync"
+	"time"
 
 	quic "github.com/lucas-clemente/quic-go"
 )
 
-type server struct {
+// A Listener is a QUIC listener.
+// It mirrors net.TCPListener.
+type Listener struct {
 	quicServer quic.Listener
+	// conn is the socket created by the listener.
+	// It is nil if the socket is owned by the caller.
+	conn     net.PacketConn
+	deadline *deadline
+
+	mutex       sync.Mutex
+	closeChan   chan struct{}      // closed when the listener stops accepting connections
+	closeCode   uint64             // used to close connections during Shutdown
+	closeReason string             // used to close connections during Shutdown
+	released    bool               // set when the QUIC listener is closed
+	conns       map[*Conn]struct{} // connections returned by Accept that are still open
+	drained     chan struct{}      // closed during Shutdown, once all connections are closed
 }
 
-var _ net.Listener = &server{}
+var _ net.Listener = &Listener{}
+
+func newListener(ln quic.Listener) *Listener {
+	return &Listener{
+		quicServer: ln,
+		deadline:   newDeadline(),
+		closeChan:  make(chan struct{}),
+		conns:      make(map[*Conn]struct{}),
+	}
+}
 
 // Accept waits for and returns the next connection to the listener.
-func (s *server) Accept() (net.Conn, error) {
-	sess, err := s.quicServer.Accept(context.Background())
+// The connection is a *Conn.
+// Errors are returned as a *net.OpError.
+// See AcceptContext for details.
+func (l *Listener) Accept() (net.Conn, error) {
+	c, err := l.AcceptContext(context.Background())
 	if err != nil {
 		return nil, err
 	}
-	qconn, err := newConn(sess)
+	return c, nil
+}
+
+// AcceptContext waits for and returns the next connection to the listener.
+// If the context is canceled or expires, or the deadline set by SetDeadline is exceeded,
+// before a connection is accepted, AcceptContext returns.
+// A timeout error is returned after the deadline, see net.Error.
+// Once the connection is accepted, the context doesn't affect it.
+//
+// Errors are only returned if the listener is unusable, for example after it was closed or shut down (ErrClosed),
+// or for temporary errors, like timeouts.
+// Errors of individual connections don't affect Accept: the stream is accepted in the background,
+// and if that fails, for example because the client sent an invalid preamble,
+// or because it went away before opening the stream, the error is returned by Read and Write on the connection.
+// Errors are returned as a *net.OpError.
+func (l *Listener) AcceptContext(ctx context.Context) (*Conn, error) {
+	if isClosedChan(l.closeChan) {
+		return nil, newOpError("accept", nil, l.Addr(), ErrClosed)
+	}
+	deadline := l.deadline.wait()
+	if isClosedChan(deadline) {
+		return nil, newOpError("accept", nil, l.Addr(), errDeadline)
+	}
+	acceptCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-deadline:
+			cancel()
+		case <-l.closeChan:
+			cancel()
+		case <-acceptCtx.Done():
+		}
+	}()
+	sess, err := l.quicServer.Accept(acceptCtx)
 	if err != nil {
-		return nil, err
+		switch {
+		case isClosedChan(l.closeChan):
+			err = ErrClosed
+		case ctx.Err() == nil && isClosedChan(deadline):
+			err = errDeadline
+		}
+		return nil, newOpError("accept", nil, l.Addr(), err)
+	}
+	qconn := newServerConn(sess)
+	if !l.trackConn(qconn) {
+		l.mutex.Lock()
+		code, reason := l.closeCode, l.closeReason
+		l.mutex.Unlock()
+		sess.CloseWithError(quic.ErrorCode(code), reason)
+		return nil, newOpError("accept", nil, l.Addr(), ErrClosed)
 	}
 	return qconn, nil
 }
 
-// Close closes the listener.
-// Any blocked Accept operations will be unblocked and return errors.
-func (s *server) Close() error {
-	return s.quicServer.Close()
+// trackConn adds a connection to the connections tracked for Shutdown.
+// It returns false if the listener doesn't accept connections any more.
+func (l *Listener) trackConn(c *Conn) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if isClosedChan(l.closeChan) {
+		return false
+	}
+	l.conns[c] = struct{}{}
+	go func() {
+		<-c.Context().Done()
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		delete(l.conns, c)
+		if len(l.conns) == 0 && l.drained != nil && !isClosedChan(l.drained) {
+			close(l.drained)
+		}
+	}()
+	return true
+}
+
+// SetDeadline sets the deadline associated with the listener.
+// It applies to future and pending calls to Accept and AcceptContext.
+// A zero time value disables the deadline.
+func (l *Listener) SetDeadline(t time.Time) error {
+	l.deadline.set(t)
+	return nil
+}
+
+// Close closes the listener, and all connections accepted from it.
+// Any blocked Accept operations will be unblocked and return ErrClosed.
+// The socket is closed, unless it is owned by the caller.
+// Close can be used to abort a Shutdown.
+func (l *Listener) Close() error {
+	l.stopAccepting()
+	if !l.markReleased() {
+		return newOpError("close", nil, l.Addr(), ErrClosed)
+	}
+	return l.release()
+}
+
+// Shutdown gracefully shuts down the listener, like http.Server.Shutdown.
+// It stops accepting connections, waits for all connections returned by Accept to be closed,
+// and then closes the listener.
+// If the context expires first, the remaining connections are closed, and the context's error is returned.
+// Connections established by peers during Shutdown are closed right away.
+// Errors closing the listener are returned as a *net.OpError.
+func (l *Listener) Shutdown(ctx context.Context) error {
+	return l.shutdown(ctx, ErrorCodeNoError, "")
+}
+
+// ShutdownWithError is like Shutdown, but signals the code and the reason to the peers
+// of connections that are closed by the listener, see Conn.CloseWithError.
+// The code must be smaller than 2^62, otherwise an error is returned and the listener is not shut down.
+func (l *Listener) ShutdownWithError(ctx context.Context, code uint64, reason string) error {
+	if err := checkErrorCode(code); err != nil {
+		return newOpError("close", nil, l.Addr(), err)
+	}
+	return l.shutdown(ctx, code, reason)
+}
+
+func (l *Listener) shutdown(ctx context.Context, code uint64, reason string) error {
+	l.mutex.Lock()
+	l.closeCode = code
+	l.closeReason = reason
+	l.mutex.Unlock()
+	if !l.stopAccepting() {
+		return newOpError("close", nil, l.Addr(), ErrClosed)
+	}
+	// quic-go closes all sessions when the QUIC listener is closed,
+	// so it is kept open until the connections are closed.
+	go l.rejectSessions(code, reason)
+
+	l.mutex.Lock()
+	l.drained = make(chan struct{})
+	if len(l.conns) == 0 {
+		close(l.drained)
+	}
+	drained := l.drained
+	l.mutex.Unlock()
+
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+		l.mutex.Lock()
+		conns := make([]*Conn, 0, len(l.conns))
+		for c := range l.conns {
+			conns = append(conns, c)
+		}
+		l.mutex.Unlock()
+		for _, c := range conns {
+			c.session.CloseWithError(quic.ErrorCode(code), reason)
+		}
+	}
+	if l.markReleased() {
+		if rerr := l.release(); err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
+
+// rejectSessions closes sessions that are established during Shutdown.
+// It returns when the QUIC listener is closed.
+func (l *Listener) rejectSessions(code uint64, reason string) {
+	for {
+		sess, err := l.quicServer.Accept(context.Background())
+		if err != nil {
+			return
+		}
+		sess.CloseWithError(quic.ErrorCode(code), reason)
+	}
+}
+
+// stopAccepting makes Accept return ErrClosed.
+// It returns false if the listener already stopped accepting connections.
+func (l *Listener) stopAccepting() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if isClosedChan(l.closeChan) {
+		return false
+	}
+	close(l.closeChan)
+	return true
+}
+
+// markReleased returns false if the listener was already released.
+func (l *Listener) markReleased() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.released {
+		return false
+	}
+	l.released = true
+	return true
+}
+
+// release closes the QUIC listener, and the socket, if it was created by the listener.
+func (l *Listener) release() error {
+	err := l.quicServer.Close()
+	if l.conn != nil {
+		if cerr := l.conn.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return newOpError("close", nil, l.Addr(), err)
 }
 
 // Addr returns the listener's network address.
-func (s *server) Addr() net.Addr {
-	return s.quicServer.Addr()
+func (l *Listener) Addr() net.Addr {
+	return l.quicServer.Addr()
 }
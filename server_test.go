@@ -6,6 +6,7 @@ import (
 	"errors"
 	"io"
 	"net"
+	"sync"
 	"time"
 
 	quic "github.com/lucas-clemente/quic-go"
@@ -46,80 +47,142 @@ func (c *mockPacketConn) SetReadDeadline(t time.Time) error  { panic("not implem
 func (c *mockPacketConn) SetWriteDeadline(t time.Time) error { panic("not implemented") }
 
 type mockStream struct {
-	id          quic.StreamID
-	closed      bool
-	dataWritten bytes.Buffer
-	dataToRead  bytes.Buffer
+	id quic.StreamID
+
+	mutex         sync.Mutex
+	closed        bool
+	dataWritten   bytes.Buffer
+	dataToRead    bytes.Buffer
+	readDeadline  time.Time
+	writeDeadline time.Time
+	canceledRead  bool
+	canceledWrite bool
+	readErr       error
+	writeErr      error
+	blockRead     chan struct{} // if set, Read blocks until it is closed
+	blockWrite    chan struct{} // if set, Write blocks until it is closed
 }
 
 var _ quic.Stream = &mockStream{}
 
 func (m *mockStream) Read(p []byte) (int, error) {
+	if m.blockRead != nil {
+		<-m.blockRead
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.readErr != nil {
+		return 0, m.readErr
+	}
 	return m.dataToRead.Read(p)
 }
+func (m *mockStream) Write(p []byte) (int, error) {
+	if m.blockWrite != nil {
+		<-m.blockWrite
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.writeErr != nil {
+		return 0, m.writeErr
+	}
+	return m.dataWritten.Write(p)
+}
 func (m *mockStream) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 	m.closed = true
 	return nil
 }
-func (m *mockStream) Write(p []byte) (int, error)      { return m.dataWritten.Write(p) }
-func (m *mockStream) StreamID() quic.StreamID          { return m.id }
-func (m *mockStream) Context() context.Context         { panic("not implemented") }
-func (m *mockStream) SetReadDeadline(time.Time) error  { panic("not implemented") }
-func (m *mockStream) SetWriteDeadline(time.Time) error { panic("not implemented") }
-func (m *mockStream) SetDeadline(time.Time) error      { panic("not implemented") }
-func (m *mockStream) CancelRead(quic.ErrorCode)        { panic("not implemented") }
-func (m *mockStream) CancelWrite(quic.ErrorCode)       { panic("not implemented") }
+func (m *mockStream) StreamID() quic.StreamID  { return m.id }
+func (m *mockStream) Context() context.Context { panic("not implemented") }
+func (m *mockStream) SetReadDeadline(t time.Time) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.readDeadline = t
+	return nil
+}
+func (m *mockStream) SetWriteDeadline(t time.Time) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.writeDeadline = t
+	return nil
+}
+func (m *mockStream) SetDeadline(t time.Time) error {
+	m.SetReadDeadline(t)
+	return m.SetWriteDeadline(t)
+}
+func (m *mockStream) CancelRead(quic.ErrorCode) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.canceledRead = true
+}
+func (m *mockStream) CancelWrite(quic.ErrorCode) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.canceledWrite = true
+}
 
 type mockQuicListener struct {
-	blockAccept  chan struct{} // close this to make accept return
-	sessToAccept *mockSession
-	addr         net.Addr
-	closeErr     error
-	acceptErr    error
+	blockAccept      chan struct{} // close this to make accept return
+	sessToAccept     *mockSession
+	sessionsToAccept chan quic.Session
+	addr             net.Addr
+	closeErr         error
+	acceptErr        error
+	closed           chan struct{}
 }
 
 func newMockQuicListener() *mockQuicListener {
 	return &mockQuicListener{
-		blockAccept: make(chan struct{}),
+		blockAccept:      make(chan struct{}),
+		sessionsToAccept: make(chan quic.Session, 10),
+		closed:           make(chan struct{}),
 	}
 }
 
-func (l *mockQuicListener) Accept(context.Context) (quic.Session, error) {
-	<-l.blockAccept
-	return l.sessToAccept, l.acceptErr
+func (l *mockQuicListener) Accept(ctx context.Context) (quic.Session, error) {
+	select {
+	case <-l.blockAccept:
+		return l.sessToAccept, l.acceptErr
+	case sess := <-l.sessionsToAccept:
+		return sess, nil
+	case <-l.closed:
+		return nil, errors.New("server closed")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 }
 func (l *mockQuicListener) Addr() net.Addr { return l.addr }
-func (l *mockQuicListener) Close() error   { return l.closeErr }
+func (l *mockQuicListener) Close() error {
+	close(l.closed)
+	return l.closeErr
+}
 
 var _ quic.Listener = &mockQuicListener{}
 
 var _ = Describe("Server", func() {
 	var (
-		s  *server
+		s  *Listener
 		ln *mockQuicListener
 	)
 
 	BeforeEach(func() {
 		ln = newMockQuicListener()
-		s = &server{
-			quicServer: ln,
-		}
+		s = newListener(ln)
 	})
 
 	It("waits for new connections", func() {
-		ln.sessToAccept = &mockSession{
-			streamToOpen: &mockStream{},
-		}
-		var returned bool
+		ln.sessToAccept = newMockSession()
+		done := make(chan struct{})
 		go func() {
 			defer GinkgoRecover()
 			_, err := s.Accept()
 			Expect(err).ToNot(HaveOccurred())
-			returned = true
+			close(done)
 		}()
-		Consistently(func() bool { return returned }).Should(BeFalse())
+		Consistently(done).ShouldNot(BeClosed())
 		close(ln.blockAccept)
-		Eventually(func() bool { return returned }).Should(BeTrue())
+		Eventually(done).Should(BeClosed())
 	})
 
 	It("errors if it can't accept a connection", func() {
@@ -127,7 +190,235 @@ var _ = Describe("Server", func() {
 		testErr := errors.New("accept error")
 		ln.acceptErr = testErr
 		_, err := s.Accept()
-		Expect(err).To(MatchError(testErr))
+		Expect(unwrapOpError(err, "accept")).To(MatchError(testErr))
+	})
+
+	It("returns errors setting up a connection from Read", func() {
+		sess := newMockSession()
+		ln.sessionsToAccept <- sess
+		c, err := s.Accept()
+		Expect(err).ToNot(HaveOccurred())
+		str := &mockStream{id: streamID}
+		str.dataToRead.Write([]byte{0x42}) // invalid preamble
+		sess.streamsToAccept <- str
+		_, err = c.Read(make([]byte, 1))
+		Expect(unwrapOpError(err, "read")).To(MatchError(errInvalidPreamble))
+		Eventually(sess.isClosed).Should(BeTrue())
+		Expect(sess.closedWithCode).To(BeEquivalentTo(ErrorCodeProtocolViolation))
+		// the listener keeps accepting connections
+		ln.sessionsToAccept <- newMockSession()
+		_, err = s.Accept()
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	Context("closing", func() {
+		It("returns ErrClosed after it was closed", func() {
+			Expect(s.Close()).To(Succeed())
+			_, err := s.Accept()
+			Expect(unwrapOpError(err, "accept")).To(Equal(ErrClosed))
+		})
+
+		It("returns ErrClosed from a pending Accept", func() {
+			ln.acceptErr = errors.New("server closed")
+			errChan := make(chan error, 1)
+			go func() {
+				_, err := s.Accept()
+				errChan <- err
+			}()
+			Consistently(errChan).ShouldNot(Receive())
+			Expect(s.Close()).To(Succeed())
+			close(ln.blockAccept)
+			var err error
+			Eventually(errChan).Should(Receive(&err))
+			Expect(unwrapOpError(err, "accept")).To(Equal(ErrClosed))
+		})
+
+		It("returns other errors unchanged", func() {
+			testErr := errors.New("read error")
+			ln.acceptErr = testErr
+			close(ln.blockAccept)
+			_, err := s.Accept()
+			Expect(unwrapOpError(err, "accept")).To(Equal(testErr))
+		})
+
+		It("returns ErrClosed when closed twice", func() {
+			Expect(s.Close()).To(Succeed())
+			Expect(unwrapOpError(s.Close(), "close")).To(Equal(ErrClosed))
+		})
+	})
+
+	Context("shutting down", func() {
+		It("shuts down if there are no connections", func() {
+			Expect(s.Shutdown(context.Background())).To(Succeed())
+			Expect(ln.closed).To(BeClosed())
+			_, err := s.Accept()
+			Expect(unwrapOpError(err, "accept")).To(Equal(ErrClosed))
+		})
+
+		It("unblocks a pending Accept", func() {
+			errChan := make(chan error, 1)
+			go func() {
+				_, err := s.Accept()
+				errChan <- err
+			}()
+			Consistently(errChan).ShouldNot(Receive())
+			Expect(s.Shutdown(context.Background())).To(Succeed())
+			var err error
+			Eventually(errChan).Should(Receive(&err))
+			Expect(unwrapOpError(err, "accept")).To(Equal(ErrClosed))
+		})
+
+		It("waits for connections to be closed", func() {
+			sess := newMockSession()
+			ln.sessionsToAccept <- sess
+			_, err := s.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				Expect(s.Shutdown(context.Background())).To(Succeed())
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			Expect(ln.closed).ToNot(BeClosed())
+			sess.ctxCancel() // the connection is closed
+			Eventually(done).Should(BeClosed())
+			Expect(ln.closed).To(BeClosed())
+			Expect(sess.isClosed()).To(BeFalse())
+		})
+
+		It("closes the remaining connections when the context expires", func() {
+			sess := newMockSession()
+			ln.sessionsToAccept <- sess
+			_, err := s.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			Expect(s.ShutdownWithError(ctx, 0x42, "shutting down")).To(MatchError(context.DeadlineExceeded))
+			Expect(sess.isClosed()).To(BeTrue())
+			Expect(sess.closedWithCode).To(BeEquivalentTo(0x42))
+			Expect(sess.closedWithError).To(Equal("shutting down"))
+			Expect(ln.closed).To(BeClosed())
+		})
+
+		It("closes connections established during Shutdown", func() {
+			sess := newMockSession()
+			ln.sessionsToAccept <- sess
+			_, err := s.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			go s.ShutdownWithError(context.Background(), 0x42, "shutting down")
+			newSess := newMockSession()
+			ln.sessionsToAccept <- newSess
+			Eventually(newSess.isClosed).Should(BeTrue())
+			Expect(newSess.closedWithCode).To(BeEquivalentTo(0x42))
+			sess.ctxCancel()
+			Eventually(ln.closed).Should(BeClosed())
+		})
+
+		It("aborts Shutdown when closed", func() {
+			sess := newMockSession()
+			ln.sessionsToAccept <- sess
+			_, err := s.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				Expect(s.Shutdown(context.Background())).To(Succeed())
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			Expect(s.Close()).To(Succeed())
+			// closing the QUIC listener closes all sessions
+			sess.ctxCancel()
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("returns ErrClosed if the listener was already closed", func() {
+			Expect(s.Close()).To(Succeed())
+			Expect(unwrapOpError(s.Shutdown(context.Background()), "close")).To(Equal(ErrClosed))
+		})
+
+		It("rejects error codes that don't fit into 62 bits", func() {
+			sess := newMockSession()
+			ln.sessionsToAccept <- sess
+			_, err := s.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			err = s.ShutdownWithError(context.Background(), 1<<62, "shutting down")
+			Expect(unwrapOpError(err, "close")).To(MatchError(ContainSubstring("exceeds the maximum")))
+			Expect(sess.isClosed()).To(BeFalse())
+			Expect(ln.closed).ToNot(BeClosed())
+			// the listener is still accepting connections
+			ln.sessionsToAccept <- newMockSession()
+			_, err = s.Accept()
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+
+	It("accepts connections using a context", func() {
+		ln.sessToAccept = newMockSession()
+		close(ln.blockAccept)
+		c, err := s.AcceptContext(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c).ToNot(BeNil())
+	})
+
+	It("stops accepting when the context is canceled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			cancel()
+		}()
+		_, err := s.AcceptContext(ctx)
+		Expect(unwrapOpError(err, "accept")).To(MatchError(context.Canceled))
+	})
+
+	Context("deadlines", func() {
+		It("returns a timeout error if the deadline is in the past", func() {
+			Expect(s.SetDeadline(time.Now().Add(-time.Second))).To(Succeed())
+			_, err := s.Accept()
+			Expect(unwrapOpError(err, "accept")).To(Equal(errDeadline))
+			Expect(err.(net.Error).Timeout()).To(BeTrue())
+		})
+
+		It("unblocks a pending Accept when the deadline expires", func() {
+			Expect(s.SetDeadline(time.Now().Add(50 * time.Millisecond))).To(Succeed())
+			start := time.Now()
+			_, err := s.Accept()
+			Expect(time.Since(start)).To(BeNumerically("~", 50*time.Millisecond, 40*time.Millisecond))
+			Expect(err.(net.Error).Timeout()).To(BeTrue())
+		})
+
+		It("unblocks a pending Accept when the deadline is moved into the past", func() {
+			errChan := make(chan error, 1)
+			go func() {
+				_, err := s.AcceptContext(context.Background())
+				errChan <- err
+			}()
+			Consistently(errChan).ShouldNot(Receive())
+			Expect(s.SetDeadline(time.Now())).To(Succeed())
+			var err error
+			Eventually(errChan).Should(Receive(&err))
+			Expect(unwrapOpError(err, "accept")).To(Equal(errDeadline))
+		})
+
+		It("accepts connections after the deadline is reset", func() {
+			Expect(s.SetDeadline(time.Now())).To(Succeed())
+			_, err := s.Accept()
+			Expect(err).To(HaveOccurred())
+			Expect(s.SetDeadline(time.Time{})).To(Succeed())
+			ln.sessToAccept = newMockSession()
+			close(ln.blockAccept)
+			_, err = s.Accept()
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("returns the context's error if the context is canceled before the deadline", func() {
+			Expect(s.SetDeadline(time.Now().Add(time.Hour))).To(Succeed())
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			_, err := s.AcceptContext(ctx)
+			Expect(unwrapOpError(err, "accept")).To(MatchError(context.DeadlineExceeded))
+		})
 	})
 
 	It("returns the address of the underlying conn", func() {
@@ -139,7 +430,23 @@ var _ = Describe("Server", func() {
 	It("closes", func() {
 		testErr := errors.New("close error")
 		ln.closeErr = testErr
-		Expect(s.Close()).To(MatchError(testErr))
+		Expect(unwrapOpError(s.Close(), "close")).To(MatchError(testErr))
+	})
+
+	It("closes the socket it created", func() {
+		conn := &mockPacketConn{}
+		s.conn = conn
+		Expect(s.Close()).To(Succeed())
+		Expect(conn.closed).To(BeTrue())
+	})
+
+	It("closes the socket it created, if closing the QUIC listener fails", func() {
+		testErr := errors.New("close error")
+		ln.closeErr = testErr
+		conn := &mockPacketConn{}
+		s.conn = conn
+		Expect(unwrapOpError(s.Close(), "close")).To(MatchError(testErr))
+		Expect(conn.closed).To(BeTrue())
 	})
 
 	// It("unblocks Accepts when it is closed", func() {